@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	awssigner "github.com/shff/aws_signer"
+)
+
+// Longest delay between retries of a throttled invocation, when Lambda
+// doesn't say how long to wait.
+const maxRetryDelay = 20 * time.Second
+
+// InvocationType selects how Lambda runs the function.
+type InvocationType string
+
+const (
+	// RequestResponse waits for the function and returns its result
+	RequestResponse InvocationType = "RequestResponse"
+	// Event queues the invocation and returns at once
+	Event InvocationType = "Event"
+	// DryRun only checks that the caller may invoke the function
+	DryRun InvocationType = "DryRun"
+)
+
+// Client invokes Lambda functions through the Invoke API.
+type Client struct {
+	Region      string
+	Credentials awssigner.CredentialsProvider
+	// Endpoint overrides https://lambda.<region>.amazonaws.com, such as
+	// with the URL of a local stand-in
+	Endpoint   string
+	HTTPClient *http.Client
+	// MaxRetries is how many times a throttled invocation is retried
+	MaxRetries int
+}
+
+// NewClient returns a client for region that signs with creds.
+func NewClient(region string, creds awssigner.CredentialsProvider) *Client {
+	return &Client{Region: region, Credentials: creds, MaxRetries: 3}
+}
+
+// InvokeInput describes one invocation.
+type InvokeInput struct {
+	// FunctionName is a name, a partial ARN or a full ARN
+	FunctionName string
+	// Qualifier is a version or alias; empty invokes $LATEST
+	Qualifier      string
+	InvocationType InvocationType
+	// LogTail asks for the last 4 KB of the function's log, which Lambda
+	// only returns for RequestResponse invocations
+	LogTail bool
+	Payload []byte
+}
+
+// InvokeOutput is the result of a successful invocation.
+type InvokeOutput struct {
+	StatusCode      int
+	Payload         []byte
+	ExecutedVersion string
+	Log             string
+}
+
+// FunctionError is returned when the function itself failed: Lambda
+// accepted the invocation but the handler returned an error or crashed.
+type FunctionError struct {
+	// Kind is the X-Amz-Function-Error header, Handled or Unhandled
+	Kind         string
+	ErrorType    string   `json:"errorType"`
+	ErrorMessage string   `json:"errorMessage"`
+	StackTrace   []string `json:"stackTrace"`
+	Payload      []byte   `json:"-"`
+	Log          string   `json:"-"`
+}
+
+func (e *FunctionError) Error() string {
+	if e.ErrorType == "" {
+		return fmt.Sprintf("function error (%s): %s", e.Kind, e.ErrorMessage)
+	}
+	return fmt.Sprintf("function error (%s): %s: %s", e.Kind, e.ErrorType, e.ErrorMessage)
+}
+
+// APIError is returned when Lambda rejected the invocation, such as with
+// ResourceNotFoundException or TooManyRequestsException.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	// RetryAfter is how long Lambda asked to wait before retrying
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("lambda: %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// Throttled reports whether the invocation was rejected for exceeding
+// the function's or the account's concurrency.
+func (e *APIError) Throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.Type == "TooManyRequestsException"
+}
+
+// Invoke runs the function, retrying with exponential backoff while Lambda
+// throttles it.
+func (c *Client) Invoke(ctx context.Context, in InvokeInput) (*InvokeOutput, error) {
+	if in.FunctionName == "" {
+		return nil, errors.New("function name is required")
+	}
+	switch in.InvocationType {
+	case "":
+		in.InvocationType = RequestResponse
+	case RequestResponse, Event, DryRun:
+	default:
+		return nil, fmt.Errorf("unknown invocation type %q", in.InvocationType)
+	}
+
+	for attempt := 0; ; attempt++ {
+		out, err := c.invoke(ctx, in)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Throttled() || attempt >= c.MaxRetries {
+			return out, err
+		}
+
+		// Unless Lambda said how long to wait
+		delay := apiErr.RetryAfter
+		if delay == 0 {
+			delay = backoff(attempt)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a delay with full jitter over 100ms doubled for every
+// attempt, up to maxRetryDelay.
+func backoff(attempt int) time.Duration {
+	ceiling := 100 * time.Millisecond
+	for i := 0; i < attempt && ceiling < maxRetryDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > maxRetryDelay {
+		ceiling = maxRetryDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+func (c *Client) invoke(ctx context.Context, in InvokeInput) (*InvokeOutput, error) {
+	req, err := c.newRequest(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return nil, parseAPIError(resp, body)
+	}
+
+	var log string
+	if tail := resp.Header.Get("X-Amz-Log-Result"); tail != "" {
+		decoded, err := base64.StdEncoding.DecodeString(tail)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode log: %w", err)
+		}
+		log = string(decoded)
+	}
+
+	if kind := resp.Header.Get("X-Amz-Function-Error"); kind != "" {
+		fnErr := &FunctionError{Kind: kind, Payload: body, Log: log}
+		if err := json.Unmarshal(body, fnErr); err != nil {
+			fnErr.ErrorMessage = string(body)
+		}
+		return nil, fnErr
+	}
+
+	return &InvokeOutput{
+		StatusCode:      resp.StatusCode,
+		Payload:         body,
+		ExecutedVersion: resp.Header.Get("X-Amz-Executed-Version"),
+		Log:             log,
+	}, nil
+}
+
+// newRequest builds and signs an Invoke request; it is signed anew for
+// every attempt so that retries carry a fresh date.
+func (c *Client) newRequest(ctx context.Context, in InvokeInput) (*http.Request, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://lambda.%s.amazonaws.com", c.Region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if c.Credentials == nil {
+		return nil, errors.New("no credentials configured")
+	}
+	var query map[string]string
+	if in.Qualifier != "" {
+		query = map[string]string{"Qualifier": in.Qualifier}
+	}
+	headers := map[string]string{
+		"Content-Type":          "application/json",
+		"X-Amz-Invocation-Type": string(in.InvocationType),
+	}
+	if in.LogTail {
+		headers["X-Amz-Log-Type"] = "Tail"
+	}
+
+	// The signer escapes the function name, the ":" of an ARN included
+	signer := awssigner.Signer{Service: "lambda", Region: c.Region, Credentials: c.Credentials}
+	path := strings.TrimSuffix(u.Path, "/") + "/2015-03-31/functions/" + in.FunctionName + "/invocations"
+	req, err := signer.Sign(ctx, "POST", u.Host, path, query, in.Payload, headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+	req.URL.Scheme = u.Scheme
+	return req, nil
+}
+
+// Helper: API errors name their type in X-Amzn-ErrorType, which may carry
+// a ":"-separated suffix, and their message in the JSON body
+func parseAPIError(resp *http.Response, body []byte) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	apiErr.Type, _, _ = strings.Cut(resp.Header.Get("X-Amzn-ErrorType"), ":")
+
+	var payload struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		if apiErr.Type == "" {
+			apiErr.Type = payload.Type
+		}
+		apiErr.Message = payload.Message
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
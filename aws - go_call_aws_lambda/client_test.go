@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssigner "github.com/shff/aws_signer"
+)
+
+type testSecrets map[string]string
+
+func (s testSecrets) SecretKey(ctx context.Context, accessKey string) (string, error) {
+	if secretKey, ok := s[accessKey]; ok {
+		return secretKey, nil
+	}
+	return "", errors.New("no such access key")
+}
+
+// invocation is what the stand-in received.
+type invocation struct {
+	Path           string
+	Qualifier      string
+	InvocationType string
+	LogType        string
+	SecurityToken  string
+	Payload        string
+}
+
+// standIn runs handler behind a Lambda endpoint that checks signatures,
+// recording what it received.
+func standIn(t *testing.T, handler func(w http.ResponseWriter, attempt int)) (*Client, *[]invocation) {
+	t.Helper()
+	var mu sync.Mutex
+	var invocations []invocation
+	v := &awssigner.Verifier{Service: "lambda", Region: "us-east-1", Secrets: testSecrets{"AKID": "SECRET"}}
+	server := httptest.NewServer(v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		invocations = append(invocations, invocation{
+			Path:           r.URL.EscapedPath(),
+			Qualifier:      r.URL.Query().Get("Qualifier"),
+			InvocationType: r.Header.Get("X-Amz-Invocation-Type"),
+			LogType:        r.Header.Get("X-Amz-Log-Type"),
+			SecurityToken:  r.Header.Get("X-Amz-Security-Token"),
+			Payload:        string(body),
+		})
+		attempt := len(invocations)
+		mu.Unlock()
+		handler(w, attempt)
+	})))
+	t.Cleanup(server.Close)
+
+	creds := awssigner.StaticProvider{Credentials: awssigner.Credentials{AccessKey: "AKID", SecretKey: "SECRET", SessionToken: "TOKEN"}}
+	client := NewClient("us-east-1", creds)
+	client.Endpoint = server.URL
+	return client, &invocations
+}
+
+func TestInvoke(t *testing.T) {
+	client, invocations := standIn(t, func(w http.ResponseWriter, attempt int) {
+		w.Header().Set("X-Amz-Executed-Version", "7")
+		w.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte("START RequestId: 1\nEND RequestId: 1\n")))
+		io.WriteString(w, `{"ok":true}`)
+	})
+
+	out, err := client.Invoke(context.Background(), InvokeInput{
+		FunctionName: "arn:aws:lambda:us-east-1:123456789012:function:my-function",
+		Qualifier:    "prod",
+		LogTail:      true,
+		Payload:      []byte(`{"key":"value"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.StatusCode != http.StatusOK || string(out.Payload) != `{"ok":true}` || out.ExecutedVersion != "7" {
+		t.Errorf("got %+v", out)
+	}
+	if out.Log != "START RequestId: 1\nEND RequestId: 1\n" {
+		t.Errorf("got log %q", out.Log)
+	}
+
+	want := invocation{
+		Path:           "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aus-east-1%3A123456789012%3Afunction%3Amy-function/invocations",
+		Qualifier:      "prod",
+		InvocationType: "RequestResponse",
+		LogType:        "Tail",
+		SecurityToken:  "TOKEN",
+		Payload:        `{"key":"value"}`,
+	}
+	if len(*invocations) != 1 || (*invocations)[0] != want {
+		t.Errorf("got invocations %+v, want %+v", *invocations, want)
+	}
+}
+
+func TestInvokeAsynchronously(t *testing.T) {
+	for _, test := range []struct {
+		invocationType InvocationType
+		status         int
+	}{
+		{Event, http.StatusAccepted},
+		{DryRun, http.StatusNoContent},
+	} {
+		t.Run(string(test.invocationType), func(t *testing.T) {
+			client, invocations := standIn(t, func(w http.ResponseWriter, attempt int) {
+				w.WriteHeader(test.status)
+			})
+			out, err := client.Invoke(context.Background(), InvokeInput{FunctionName: "my-function", InvocationType: test.invocationType})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.StatusCode != test.status || len(out.Payload) != 0 {
+				t.Errorf("got %+v", out)
+			}
+			if got := (*invocations)[0]; got.InvocationType != string(test.invocationType) || got.Qualifier != "" || got.LogType != "" {
+				t.Errorf("got invocation %+v", got)
+			}
+		})
+	}
+}
+
+func TestInvokeFunctionError(t *testing.T) {
+	client, _ := standIn(t, func(w http.ResponseWriter, attempt int) {
+		w.Header().Set("X-Amz-Function-Error", "Unhandled")
+		w.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte("boom\n")))
+		io.WriteString(w, `{"errorType":"TypeError","errorMessage":"x is undefined","stackTrace":["at handler (index.js:3)"]}`)
+	})
+
+	_, err := client.Invoke(context.Background(), InvokeInput{FunctionName: "my-function", LogTail: true})
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) {
+		t.Fatalf("got %v, want a FunctionError", err)
+	}
+	if fnErr.Kind != "Unhandled" || fnErr.ErrorType != "TypeError" || fnErr.ErrorMessage != "x is undefined" || len(fnErr.StackTrace) != 1 || fnErr.Log != "boom\n" {
+		t.Errorf("got %+v", fnErr)
+	}
+	if got := fnErr.Error(); got != "function error (Unhandled): TypeError: x is undefined" {
+		t.Errorf("got message %q", got)
+	}
+}
+
+func TestInvokeRetriesThrottling(t *testing.T) {
+	client, invocations := standIn(t, func(w http.ResponseWriter, attempt int) {
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.Header().Set("X-Amzn-ErrorType", "TooManyRequestsException:http://internal.amazon.com/coral/com.amazon.coral.service/")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"message":"Rate Exceeded."}`)
+			return
+		}
+		io.WriteString(w, `"done"`)
+	})
+
+	start := time.Now()
+	out, err := client.Invoke(context.Background(), InvokeInput{FunctionName: "my-function"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Payload) != `"done"` || len(*invocations) != 2 {
+		t.Errorf("got %q after %d invocations", out.Payload, len(*invocations))
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the Retry-After second", elapsed)
+	}
+}
+
+func TestInvokeGivesUpOnThrottling(t *testing.T) {
+	client, invocations := standIn(t, func(w http.ResponseWriter, attempt int) {
+		w.Header().Set("X-Amzn-ErrorType", "TooManyRequestsException")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"message":"Rate Exceeded."}`)
+	})
+	client.MaxRetries = 0
+
+	_, err := client.Invoke(context.Background(), InvokeInput{FunctionName: "my-function"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.Throttled() || apiErr.Message != "Rate Exceeded." {
+		t.Fatalf("got %v, want a throttling error", err)
+	}
+	if len(*invocations) != 1 {
+		t.Errorf("got %d invocations, want 1", len(*invocations))
+	}
+
+	// Other API errors aren't retried
+	client, invocations = standIn(t, func(w http.ResponseWriter, attempt int) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"__type":"ResourceNotFoundException","message":"Function not found"}`)
+	})
+	_, err = client.Invoke(context.Background(), InvokeInput{FunctionName: "missing"})
+	if !errors.As(err, &apiErr) || apiErr.Type != "ResourceNotFoundException" || len(*invocations) != 1 {
+		t.Errorf("got %v after %d invocations", err, len(*invocations))
+	}
+}
+
+func TestInvokeValidates(t *testing.T) {
+	client := NewClient("us-east-1", nil)
+	if _, err := client.Invoke(context.Background(), InvokeInput{}); err == nil || !strings.Contains(err.Error(), "function name") {
+		t.Errorf("got %v, want a missing function name error", err)
+	}
+	if _, err := client.Invoke(context.Background(), InvokeInput{FunctionName: "f", InvocationType: "Later"}); err == nil || !strings.Contains(err.Error(), `unknown invocation type "Later"`) {
+		t.Errorf("got %v, want an unknown invocation type error", err)
+	}
+	if _, err := client.Invoke(context.Background(), InvokeInput{FunctionName: "f"}); err == nil || !strings.Contains(err.Error(), "no credentials") {
+		t.Errorf("got %v, want a missing credentials error", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, attempt := range []int{0, 3, 8, 63, 64, 1000} {
+		if delay := backoff(attempt); delay < 0 || delay >= maxRetryDelay {
+			t.Errorf("attempt %d: got a delay of %s", attempt, delay)
+		}
+	}
+	if delay := backoff(0); delay >= 100*time.Millisecond {
+		t.Errorf("got a first delay of %s", delay)
+	}
+}
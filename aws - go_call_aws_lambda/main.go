@@ -1,91 +1,61 @@
 package main
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"net/http"
-	"time"
-)
+	"os"
 
-// AWS Credentials and Lambda Config
-const (
-	AccessKey    = "your-access-key"
-	SecretKey    = "your-secret-key"
-	Region       = "us-east-1"
-	FunctionName = "your-lambda-function-name"
+	awssigner "github.com/shff/aws_signer"
 )
 
-func sign(key []byte, message string) []byte {
-	mac := hmac.New(sha256.New, key)
-	mac.Write([]byte(message))
-	return mac.Sum(nil)
-}
-
-func getSignatureKey(secret, date, region, service string) []byte {
-	kDate := sign([]byte("AWS4"+secret), date)
-	kRegion := sign(kDate, region)
-	kService := sign(kRegion, service)
-	kSigning := sign(kService, "aws4_request")
-	return kSigning
-}
-
-func invokeLambda(payload []byte) ([]byte, error) {
-	// Create the request
-	url := fmt.Sprintf("https://lambda.%s.amazonaws.com/2015-03-31/functions/%s/invocations", Region, FunctionName)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
-	if err != nil {
-		return nil, err
+func main() {
+	functionName := flag.String("function", os.Getenv("LAMBDA_FUNCTION"), "function name or ARN")
+	qualifier := flag.String("qualifier", "", "version or alias to invoke")
+	invocationType := flag.String("type", string(RequestResponse), "RequestResponse, Event or DryRun")
+	tail := flag.Bool("tail", false, "print the tail of the function's log")
+	payload := flag.String("payload", `{"key": "value"}`, "JSON payload")
+	region := flag.String("region", defaultRegion(), "AWS region of the function")
+	flag.Parse()
+
+	switch InvocationType(*invocationType) {
+	case RequestResponse, Event, DryRun:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown invocation type %q: want RequestResponse, Event or DryRun\n", *invocationType)
+		os.Exit(2)
 	}
 
-	// Add headers
-	t := time.Now().UTC()
-	amzDate := t.Format("20060102T150405Z")
-	dateStamp := t.Format("20060102")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Amz-Date", amzDate)
-
-	// Create canonical request
-	canonicalHeaders := fmt.Sprintf("content-type:application/json\nx-amz-date:%s\n", amzDate)
-	signedHeaders := "content-type;x-amz-date"
-	payloadHash := fmt.Sprintf("%x", sha256.Sum256(payload))
-	canonicalRequest := fmt.Sprintf("POST\n/2015-03-31/functions/%s/invocations\n\n%s\n%s\n%s", FunctionName, canonicalHeaders, signedHeaders, payloadHash)
-
-	// Create string to sign
-	credentialScope := fmt.Sprintf("%s/%s/lambda/aws4_request", dateStamp, Region)
-	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%x", amzDate, credentialScope, sha256.Sum256([]byte(canonicalRequest)))
-
-	// Calculate signature
-	signingKey := getSignatureKey(SecretKey, dateStamp, Region, "lambda")
-	signature := hex.EncodeToString(sign(signingKey, stringToSign))
-
-	// Add authorization header
-	authorizationHeader := fmt.Sprintf(
-		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
-		AccessKey, credentialScope, signedHeaders, signature,
-	)
-	req.Header.Set("Authorization", authorizationHeader)
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	ctx := context.Background()
+	client := NewClient(*region, awssigner.DefaultCredentials())
+	response, err := client.Invoke(ctx, InvokeInput{
+		FunctionName:   *functionName,
+		Qualifier:      *qualifier,
+		InvocationType: InvocationType(*invocationType),
+		LogTail:        *tail,
+		Payload:        []byte(*payload),
+	})
+	var fnErr *FunctionError
+	if errors.As(err, &fnErr) {
+		fmt.Fprint(os.Stderr, fnErr.Log)
+		fmt.Fprintln(os.Stderr, fnErr)
+		os.Exit(1)
+	}
 	if err != nil {
-		return nil, err
+		panic(err)
 	}
-	defer resp.Body.Close()
 
-	// Read and return response
-	return io.ReadAll(resp.Body)
+	fmt.Print(response.Log)
+	fmt.Printf("Lambda Response (%d, version %s): %s\n", response.StatusCode, response.ExecutedVersion, response.Payload)
 }
 
-func main() {
-	payload := []byte(`{"key": "value"}`) // Replace with your payload
-	response, err := invokeLambda(payload)
-	if err != nil {
-		panic(err)
+// Helper: The region of the environment, as the AWS SDKs read it, or
+// us-east-1
+func defaultRegion() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
 	}
-	fmt.Println("Lambda Response:", string(response))
+	return "us-east-1"
 }
@@ -0,0 +1,140 @@
+package awssigner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Size of the chunks of a streaming upload; S3 needs at least 8 KiB in every
+// chunk but the last
+const streamingChunkSize = 64 * 1024
+
+// SignStreamingUpload returns a request that uploads size bytes of body to
+// S3 in aws-chunked encoding, each chunk signed with the signature of the
+// one before, so that the body is never held in memory to be hashed.
+func (s Signer) SignStreamingUpload(ctx context.Context, method, endpoint, path string, query map[string]string, body io.Reader, size int64, headers map[string]string) (*http.Request, error) {
+	if len(s.RegionSet) > 0 {
+		return nil, fmt.Errorf("streaming uploads are only signed with SigV4")
+	}
+	creds, err := s.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	reqURL := fmt.Sprintf("https://%s%s", endpoint, uriEncode(path, false))
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	for key, value := range query {
+		q.Set(key, value)
+	}
+	req.URL.RawQuery = q.Encode()
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(size, 10))
+
+	// The headers' signature seeds the chain of chunk signatures
+	t := time.Now().UTC()
+	signHTTPRequest(req, t, s.Service, s.Region, "STREAMING-AWS4-HMAC-SHA256-PAYLOAD", creds)
+	_, seed, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+
+	date := t.Format("20060102")
+	req.Body = &chunkSigner{
+		source:          body,
+		body:            io.LimitReader(body, size),
+		remaining:       size,
+		signingKey:      getSignatureKey(creds.SecretKey, date, s.Region, s.Service),
+		amzDate:         t.Format("20060102T150405Z"),
+		credentialScope: fmt.Sprintf("%s/%s/%s/aws4_request", date, s.Region, s.Service),
+		signature:       seed,
+		chunk:           make([]byte, streamingChunkSize),
+	}
+	req.ContentLength = chunkedLength(size)
+	return req, nil
+}
+
+// chunkedLength is the length of size bytes in signed aws-chunked encoding.
+func chunkedLength(size int64) int64 {
+	// <hex size>;chunk-signature=<64 hex digits>\r\n<data>\r\n
+	chunkLength := func(n int64) int64 {
+		return int64(len(strconv.FormatInt(n, 16))) + int64(len(";chunk-signature=")) + 64 + 2 + n + 2
+	}
+	full := size / streamingChunkSize
+	length := full * chunkLength(streamingChunkSize)
+	if rest := size % streamingChunkSize; rest > 0 {
+		length += chunkLength(rest)
+	}
+	// The final empty chunk
+	return length + chunkLength(0)
+}
+
+// chunkSigner encodes and signs the body of a streaming upload one chunk at
+// a time.
+type chunkSigner struct {
+	source          io.Reader
+	body            io.Reader
+	remaining       int64
+	signingKey      []byte
+	amzDate         string
+	credentialScope string
+	// signature of the previous chunk
+	signature string
+	chunk     []byte
+	// pending holds the encoded chunk not yet read
+	pending []byte
+	done    bool
+}
+
+func (c *chunkSigner) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *chunkSigner) nextChunk() error {
+	n, err := io.ReadFull(c.body, c.chunk)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	c.remaining -= int64(n)
+	if n == 0 {
+		if c.remaining > 0 {
+			return fmt.Errorf("body ended %d bytes short of its size", c.remaining)
+		}
+		c.done = true
+	}
+
+	data := c.chunk[:n]
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256-PAYLOAD\n%s\n%s\n%s\n%s\n%s",
+		c.amzDate, c.credentialScope, c.signature, sha256Hex(nil), sha256Hex(data),
+	)
+	c.signature = hmacHex(c.signingKey, stringToSign)
+
+	header := fmt.Sprintf("%x;chunk-signature=%s\r\n", n, c.signature)
+	c.pending = append(append(append(c.pending[:0], header...), data...), "\r\n"...)
+	return nil
+}
+
+func (c *chunkSigner) Close() error {
+	if closer, ok := c.source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
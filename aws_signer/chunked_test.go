@@ -0,0 +1,75 @@
+package awssigner
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// From "Signature Calculations for the Authorization Header: Transferring
+// Payload in Multiple Chunks" in the S3 documentation: 66560 bytes of "a",
+// signed from the seed signature of the request's headers
+func TestChunkSignatures(t *testing.T) {
+	c := &chunkSigner{
+		body:            strings.NewReader(strings.Repeat("a", 66560)),
+		remaining:       66560,
+		signingKey:      getSignatureKey("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "20130524", "us-east-1", "s3"),
+		amzDate:         "20130524T000000Z",
+		credentialScope: "20130524/us-east-1/s3/aws4_request",
+		signature:       "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9",
+		chunk:           make([]byte, streamingChunkSize),
+	}
+	body, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "10000;chunk-signature=ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648\r\n" + strings.Repeat("a", 65536) + "\r\n" +
+		"400;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n" + strings.Repeat("a", 1024) + "\r\n" +
+		"0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n\r\n"
+	if string(body) != want {
+		t.Errorf("got chunk headers %q", regexp.MustCompile(`[0-9a-f]+;chunk-signature=[0-9a-f]+`).FindAllString(string(body), -1))
+	}
+	if chunkedLength(66560) != 66824 {
+		t.Errorf("got length %d, want 66824", chunkedLength(66560))
+	}
+}
+
+func TestSignStreamingUpload(t *testing.T) {
+	s := Signer{Service: "s3", Region: "us-east-1", Credentials: s3ExampleCredentials}
+	req, err := s.SignStreamingUpload(context.Background(), "PUT", "examplebucket.s3.amazonaws.com", "/chunk object.txt", nil, strings.NewReader("hello"), 5, map[string]string{"X-Amz-Storage-Class": "REDUCED_REDUNDANCY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.EscapedPath() != "/chunk%20object.txt" {
+		t.Errorf("got path %q", req.URL.EscapedPath())
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		t.Errorf("got X-Amz-Content-Sha256 %q", got)
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-decoded-content-length;x-amz-storage-class,") {
+		t.Errorf("got Authorization %q", req.Header.Get("Authorization"))
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) != req.ContentLength {
+		t.Errorf("got %d bytes, want Content-Length %d", len(body), req.ContentLength)
+	}
+	if !regexp.MustCompile(`^5;chunk-signature=[0-9a-f]{64}\r\nhello\r\n0;chunk-signature=[0-9a-f]{64}\r\n\r\n$`).Match(body) {
+		t.Errorf("got body %q", body)
+	}
+
+	// A body shorter than its size fails the upload
+	req, err = s.SignStreamingUpload(context.Background(), "PUT", "examplebucket.s3.amazonaws.com", "/key", nil, strings.NewReader("hi"), 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(req.Body); err == nil || !strings.Contains(err.Error(), "3 bytes short") {
+		t.Errorf("got %v, want a short body error", err)
+	}
+}
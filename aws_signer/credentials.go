@@ -0,0 +1,427 @@
+package awssigner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials sign requests. Temporary credentials carry a session token,
+// sent as X-Amz-Security-Token, and expire.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Expires is zero for credentials that don't expire
+	Expires time.Time
+}
+
+// CredentialsProvider retrieves credentials, possibly over the network.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// StaticProvider returns the same credentials every time.
+type StaticProvider struct {
+	Credentials
+}
+
+func (p StaticProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	if p.AccessKey == "" || p.SecretKey == "" {
+		return Credentials{}, errors.New("static credentials are empty")
+	}
+	return p.Credentials, nil
+}
+
+// EnvProvider reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+type EnvProvider struct{}
+
+func (EnvProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	creds := Credentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return creds, nil
+}
+
+// SharedCredentialsProvider reads a profile of the shared credentials file.
+// Filename defaults to $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials,
+// and Profile to $AWS_PROFILE or "default".
+type SharedCredentialsProvider struct {
+	Filename string
+	Profile  string
+}
+
+func (p SharedCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	filename := p.Filename
+	if filename == "" {
+		filename = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, err
+		}
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := p.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer f.Close()
+
+	// Read the keys of the profile's section of the INI file
+	values := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && section == profile {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, err
+	}
+
+	creds := Credentials{
+		AccessKey:    values["aws_access_key_id"],
+		SecretKey:    values["aws_secret_access_key"],
+		SessionToken: values["aws_session_token"],
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, fmt.Errorf("profile %q in %s has no credentials", profile, filename)
+	}
+	return creds, nil
+}
+
+// AssumeRoleProvider exchanges the credentials of Source for temporary
+// credentials of a role through STS.
+type AssumeRoleProvider struct {
+	Source      CredentialsProvider
+	RoleARN     string
+	SessionName string
+	// Duration defaults to an hour
+	Duration time.Duration
+	// Endpoint defaults to https://sts.amazonaws.com and Region, which
+	// scopes the signature, to us-east-1
+	Endpoint string
+	Region   string
+	Client   *http.Client
+}
+
+func (p AssumeRoleProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	endpoint, region, duration := p.Endpoint, p.Region, p.Duration
+	if endpoint == "" {
+		endpoint = "https://sts.amazonaws.com"
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if duration == 0 {
+		duration = time.Hour
+	}
+	sessionName := p.SessionName
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("aws-signer-%d", time.Now().Unix())
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid STS endpoint: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", p.RoleARN)
+	form.Set("RoleSessionName", sessionName)
+	form.Set("DurationSeconds", strconv.Itoa(int(duration/time.Second)))
+
+	signer := Signer{Service: "sts", Region: region, Credentials: p.Source}
+	req, err := signer.Sign(ctx, "POST", u.Host, u.Path, nil, []byte(form.Encode()), map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.URL.Scheme = u.Scheme
+
+	body, err := fetch(p.Client, req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to assume role %s: %w", p.RoleARN, err)
+	}
+	var response struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse AssumeRole response: %w", err)
+	}
+	if response.Credentials.AccessKeyId == "" || response.Credentials.SecretAccessKey == "" || response.Credentials.SessionToken == "" {
+		return Credentials{}, fmt.Errorf("AssumeRole response for %s has no credentials", p.RoleARN)
+	}
+	return Credentials{
+		AccessKey:    response.Credentials.AccessKeyId,
+		SecretKey:    response.Credentials.SecretAccessKey,
+		SessionToken: response.Credentials.SessionToken,
+		Expires:      response.Credentials.Expiration,
+	}, nil
+}
+
+// ContainerProvider fetches the credentials of an ECS task or any other
+// container given AWS_CONTAINER_CREDENTIALS_RELATIVE_URI, or
+// AWS_CONTAINER_CREDENTIALS_FULL_URI with an optional
+// AWS_CONTAINER_AUTHORIZATION_TOKEN. A full URI must use HTTPS, or be on
+// the loopback interface or one of the ECS and EKS credential addresses.
+type ContainerProvider struct {
+	Client *http.Client
+}
+
+func (p ContainerProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+	if endpoint == "" {
+		return Credentials{}, errors.New("not running in a container with credentials")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if !allowedContainerEndpoint(req.URL) {
+		return Credentials{}, fmt.Errorf("container credentials endpoint %s is not HTTPS, loopback or an ECS or EKS address", req.URL.Host)
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	body, err := fetch(p.Client, req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to fetch container credentials: %w", err)
+	}
+	return parseJSONCredentials(body)
+}
+
+// IMDSProvider fetches the credentials of the role of an EC2 instance from
+// the instance metadata service, using an IMDSv2 session token. Endpoint
+// defaults to http://169.254.169.254.
+type IMDSProvider struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (p IMDSProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+	client := p.Client
+	if client == nil {
+		// The service only exists on EC2, so don't wait long elsewhere
+		client = &http.Client{Timeout: time.Second}
+	}
+
+	// Get a session token
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := fetch(client, req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get instance metadata token: %w", err)
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return fetch(client, req)
+	}
+
+	// Find the instance's role, then its credentials
+	roles, err := get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get instance role: %w", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return Credentials{}, errors.New("instance has no role")
+	}
+	body, err := get("/latest/meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get credentials of instance role %s: %w", role, err)
+	}
+	return parseJSONCredentials(body)
+}
+
+// ChainProvider returns the credentials of the first provider that has
+// them.
+type ChainProvider []CredentialsProvider
+
+func (c ChainProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	var errs []error
+	for _, provider := range c {
+		creds, err := provider.Retrieve(ctx)
+		if err == nil {
+			return creds, nil
+		}
+		errs = append(errs, err)
+	}
+	return Credentials{}, fmt.Errorf("no credentials found: %w", errors.Join(errs...))
+}
+
+// CachedProvider keeps the credentials of Provider until ExpiryWindow, five
+// minutes by default, before they expire.
+type CachedProvider struct {
+	Provider     CredentialsProvider
+	ExpiryWindow time.Duration
+
+	mu    sync.Mutex
+	creds *Credentials
+}
+
+func (p *CachedProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	window := p.ExpiryWindow
+	if window == 0 {
+		window = 5 * time.Minute
+	}
+	if p.creds != nil && (p.creds.Expires.IsZero() || time.Now().Before(p.creds.Expires.Add(-window))) {
+		return *p.creds, nil
+	}
+
+	creds, err := p.Provider.Retrieve(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	p.creds = &creds
+	return creds, nil
+}
+
+// Expire makes the next Retrieve refresh the credentials, such as after
+// AWS rejected them.
+func (p *CachedProvider) Expire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.creds = nil
+}
+
+// DefaultCredentials looks for credentials where the AWS SDKs do: the
+// environment, the shared credentials file, the container and then the
+// instance.
+func DefaultCredentials() *CachedProvider {
+	return &CachedProvider{Provider: ChainProvider{
+		EnvProvider{},
+		SharedCredentialsProvider{},
+		ContainerProvider{},
+		IMDSProvider{},
+	}}
+}
+
+// Helper: Send a request and return its body, failing on error statuses
+func fetch(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// Helper: Whether a container credentials endpoint may be sent the
+// authorization token: HTTPS, or plain HTTP to the loopback interface or the
+// link-local addresses of the ECS and EKS credential agents
+func allowedContainerEndpoint(u *url.URL) bool {
+	if u.Scheme == "https" {
+		return true
+	}
+	if u.Scheme != "http" {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.Equal(net.ParseIP("169.254.170.2")) || ip.Equal(net.ParseIP("169.254.170.23")) || ip.Equal(net.ParseIP("fd00:ec2::23"))
+}
+
+// Helper: Parse the credentials JSON of the container and instance
+// metadata services
+func parseJSONCredentials(body []byte) (Credentials, error) {
+	var response struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	if response.AccessKeyId == "" || response.SecretAccessKey == "" {
+		return Credentials{}, errors.New("response has no credentials")
+	}
+	return Credentials{
+		AccessKey:    response.AccessKeyId,
+		SecretKey:    response.SecretAccessKey,
+		SessionToken: response.Token,
+		Expires:      response.Expiration,
+	}, nil
+}
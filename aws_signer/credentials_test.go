@@ -0,0 +1,236 @@
+package awssigner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_SESSION_TOKEN", "TOKEN")
+	creds, err := EnvProvider{}.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds != (Credentials{AccessKey: "AKID", SecretKey: "SECRET", SessionToken: "TOKEN"}) {
+		t.Errorf("got %+v", creds)
+	}
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err := (EnvProvider{}).Retrieve(context.Background()); err == nil {
+		t.Error("got no error without a secret key")
+	}
+}
+
+func TestSharedCredentialsProvider(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(filename, []byte(`
+# comment
+[default]
+aws_access_key_id = AKID
+aws_secret_access_key = SECRET
+
+[work]
+; comment
+aws_access_key_id=WORKID
+aws_secret_access_key=WORKSECRET
+aws_session_token=WORKTOKEN
+
+[empty]
+region = us-east-1
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_PROFILE", "")
+
+	tests := []struct {
+		profile string
+		want    Credentials
+	}{
+		{profile: "", want: Credentials{AccessKey: "AKID", SecretKey: "SECRET"}},
+		{profile: "work", want: Credentials{AccessKey: "WORKID", SecretKey: "WORKSECRET", SessionToken: "WORKTOKEN"}},
+	}
+	for _, test := range tests {
+		creds, err := SharedCredentialsProvider{Filename: filename, Profile: test.profile}.Retrieve(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds != test.want {
+			t.Errorf("profile %q: got %+v, want %+v", test.profile, creds, test.want)
+		}
+	}
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filename)
+	t.Setenv("AWS_PROFILE", "empty")
+	if _, err := (SharedCredentialsProvider{}).Retrieve(context.Background()); err == nil || !strings.Contains(err.Error(), `profile "empty"`) {
+		t.Errorf("got %v, want a profile without credentials to fail", err)
+	}
+}
+
+func TestAssumeRoleProvider(t *testing.T) {
+	response := `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+		<AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>ROLESECRET</SecretAccessKey>
+		<SessionToken>ROLETOKEN</SessionToken><Expiration>2030-01-02T03:04:05Z</Expiration>
+	</Credentials></AssumeRoleResult></AssumeRoleResponse>`
+	var form url.Values
+	v := &Verifier{Service: "sts", Region: "us-east-1", Secrets: staticSecrets{"AKID": "SECRET"}}
+	server := httptest.NewServer(v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		io.WriteString(w, response)
+	})))
+	defer server.Close()
+
+	p := AssumeRoleProvider{Source: testCredentials, RoleARN: "arn:aws:iam::123456789012:role/test", SessionName: "session", Endpoint: server.URL}
+	creds, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Credentials{AccessKey: "ASIAROLE", SecretKey: "ROLESECRET", SessionToken: "ROLETOKEN", Expires: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if creds != want {
+		t.Errorf("got %+v, want %+v", creds, want)
+	}
+	if form.Get("Action") != "AssumeRole" || form.Get("RoleArn") != p.RoleARN || form.Get("RoleSessionName") != "session" || form.Get("DurationSeconds") != "3600" {
+		t.Errorf("got form %v", form)
+	}
+
+	// A response without credentials is an error, not empty credentials
+	response = `<AssumeRoleResponse><AssumeRoleResult></AssumeRoleResult></AssumeRoleResponse>`
+	p.SessionName = "another"
+	if _, err := p.Retrieve(context.Background()); err == nil || !strings.Contains(err.Error(), "has no credentials") {
+		t.Errorf("got %v, want an error for a response without credentials", err)
+	}
+}
+
+func TestContainerProvider(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		io.WriteString(w, `{"AccessKeyId":"ASIATASK","SecretAccessKey":"TASKSECRET","Token":"TASKTOKEN","Expiration":"2030-01-02T03:04:05Z"}`)
+	}))
+	defer server.Close()
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL+"/creds")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "secret-token")
+
+	creds, err := ContainerProvider{}.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKey != "ASIATASK" || creds.SessionToken != "TASKTOKEN" || authorization != "secret-token" {
+		t.Errorf("got %+v with Authorization %q", creds, authorization)
+	}
+
+	// The token is only sent over HTTPS or to the container agent
+	for _, endpoint := range []string{"http://example.com/creds", "http://169.254.169.254/creds", "http://10.0.0.1/creds", "file:///etc/passwd"} {
+		t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", endpoint)
+		if _, err := (ContainerProvider{}).Retrieve(context.Background()); err == nil || !strings.Contains(err.Error(), "is not HTTPS") {
+			t.Errorf("%s: got %v, want the endpoint to be refused", endpoint, err)
+		}
+	}
+	for _, endpoint := range []string{"https://example.com/creds", "http://localhost/creds", "http://127.0.0.2/creds", "http://[::1]/creds", "http://169.254.170.2/creds", "http://169.254.170.23/creds", "http://[fd00:ec2::23]/creds"} {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowedContainerEndpoint(u) {
+			t.Errorf("%s is refused", endpoint)
+		}
+	}
+}
+
+func TestIMDSProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/latest/api/token" {
+			io.WriteString(w, "imds-token")
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			io.WriteString(w, "instance-role\n")
+		case "/latest/meta-data/iam/security-credentials/instance-role":
+			io.WriteString(w, `{"AccessKeyId":"ASIAEC2","SecretAccessKey":"EC2SECRET","Token":"EC2TOKEN"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	creds, err := IMDSProvider{Endpoint: server.URL}.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds != (Credentials{AccessKey: "ASIAEC2", SecretKey: "EC2SECRET", SessionToken: "EC2TOKEN"}) {
+		t.Errorf("got %+v", creds)
+	}
+}
+
+// countingProvider returns credentials expiring at expires, counting its
+// calls.
+type countingProvider struct {
+	calls   int
+	expires time.Time
+	err     error
+}
+
+func (p *countingProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.calls++
+	if p.err != nil {
+		return Credentials{}, p.err
+	}
+	return Credentials{AccessKey: fmt.Sprintf("AKID%d", p.calls), SecretKey: "SECRET", Expires: p.expires}, nil
+}
+
+func TestChainProvider(t *testing.T) {
+	failing := &countingProvider{err: errors.New("nothing here")}
+	working := &countingProvider{}
+	creds, err := ChainProvider{failing, working, &countingProvider{}}.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKey != "AKID1" || failing.calls != 1 || working.calls != 1 {
+		t.Errorf("got %+v after %d and %d calls", creds, failing.calls, working.calls)
+	}
+
+	if _, err := (ChainProvider{failing}).Retrieve(context.Background()); err == nil || !strings.Contains(err.Error(), "nothing here") {
+		t.Errorf("got %v, want the providers' errors", err)
+	}
+}
+
+func TestCachedProvider(t *testing.T) {
+	source := &countingProvider{expires: time.Now().Add(time.Hour)}
+	p := &CachedProvider{Provider: source}
+	for i := 0; i < 2; i++ {
+		if creds, err := p.Retrieve(context.Background()); err != nil || creds.AccessKey != "AKID1" {
+			t.Fatalf("got %+v, %v", creds, err)
+		}
+	}
+	p.Expire()
+	if creds, _ := p.Retrieve(context.Background()); creds.AccessKey != "AKID2" {
+		t.Errorf("got %s after Expire, want fresh credentials", creds.AccessKey)
+	}
+
+	// Credentials are refreshed within the expiry window
+	source.expires = time.Now().Add(time.Minute)
+	p.Expire()
+	p.Retrieve(context.Background())
+	if creds, _ := p.Retrieve(context.Background()); creds.AccessKey != "AKID4" {
+		t.Errorf("got %s, want credentials about to expire to be refreshed", creds.AccessKey)
+	}
+}
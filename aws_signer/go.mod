@@ -0,0 +1,3 @@
+module github.com/shff/aws_signer
+
+go 1.23.4
@@ -0,0 +1,186 @@
+package awssigner
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Smallest part S3 accepts in a multipart upload, but for the last part
+const minPartSize = 5 << 20
+
+// MultipartUpload uploads one S3 object in parts of up to 5 GiB, which may
+// be sent in any order, concurrently, and retried on their own.
+type MultipartUpload struct {
+	Signer Signer
+	Client *http.Client
+	// Endpoint is the bucket's host, such as my-bucket.s3.amazonaws.com
+	Endpoint string
+	Key      string
+	UploadID string
+
+	mu    sync.Mutex
+	parts []completedPart
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// CreateMultipartUpload starts a multipart upload of key to the bucket at
+// endpoint. Headers such as Content-Type apply to the finished object.
+func (s Signer) CreateMultipartUpload(ctx context.Context, client *http.Client, endpoint, key string, headers map[string]string) (*MultipartUpload, error) {
+	req, err := s.Sign(ctx, "POST", endpoint, "/"+key, map[string]string{"uploads": ""}, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetch(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse multipart upload: %w", err)
+	}
+	return &MultipartUpload{Signer: s, Client: client, Endpoint: endpoint, Key: key, UploadID: result.UploadID}, nil
+}
+
+// UploadPart streams size bytes of body as part number (from 1 to 10000),
+// replacing any part uploaded with that number before.
+func (u *MultipartUpload) UploadPart(ctx context.Context, number int, body io.Reader, size int64) error {
+	query := map[string]string{"partNumber": strconv.Itoa(number), "uploadId": u.UploadID}
+	req, err := u.Signer.SignStreamingUpload(ctx, "PUT", u.Endpoint, "/"+u.Key, query, body, size, nil)
+	if err != nil {
+		return err
+	}
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload part %d: %w", number, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to upload part %d: %s: %s", number, resp.Status, bytes.TrimSpace(message))
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, part := range u.parts {
+		if part.PartNumber == number {
+			u.parts = append(u.parts[:i], u.parts[i+1:]...)
+			break
+		}
+	}
+	u.parts = append(u.parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// Complete assembles the uploaded parts into the object.
+func (u *MultipartUpload) Complete(ctx context.Context) error {
+	u.mu.Lock()
+	parts := append([]completedPart(nil), u.parts...)
+	u.mu.Unlock()
+	if len(parts) == 0 {
+		return errors.New("no parts uploaded")
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	payload, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	req, err := u.Signer.Sign(ctx, "POST", u.Endpoint, "/"+u.Key, map[string]string{"uploadId": u.UploadID}, payload, map[string]string{
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return err
+	}
+	body, err := fetch(u.Client, req)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	// S3 reports some failures in the body of a 200 response
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to parse multipart upload result: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("failed to complete multipart upload: %s: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// Abort discards the uploaded parts, which S3 otherwise keeps and bills for.
+func (u *MultipartUpload) Abort(ctx context.Context) error {
+	req, err := u.Signer.Sign(ctx, "DELETE", u.Endpoint, "/"+u.Key, map[string]string{"uploadId": u.UploadID}, nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := fetch(u.Client, req); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// UploadLarge uploads everything body holds to key as a multipart upload,
+// holding at most one part of partSize bytes in memory, and aborts the
+// upload when a part fails.
+func (s Signer) UploadLarge(ctx context.Context, client *http.Client, endpoint, key string, body io.Reader, partSize int, headers map[string]string) error {
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	upload, err := s.CreateMultipartUpload(ctx, client, endpoint, key, headers)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, partSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			upload.Abort(ctx)
+			return fmt.Errorf("failed to read part %d: %w", number, err)
+		}
+		if n == 0 && number > 1 {
+			break
+		}
+		if err := upload.UploadPart(ctx, number, bytes.NewReader(buf[:n]), int64(n)); err != nil {
+			upload.Abort(ctx)
+			return err
+		}
+		if n < partSize {
+			break
+		}
+	}
+
+	if err := upload.Complete(ctx); err != nil {
+		upload.Abort(ctx)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package awssigner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 takes multipart uploads of one object, decoding their aws-chunked
+// parts.
+type fakeS3 struct {
+	mu       sync.Mutex
+	parts    map[int]int
+	failPart int
+	complete string
+	requests []string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := r.URL.Query()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	switch {
+	case r.Method == "POST" && query.Has("uploads"):
+		io.WriteString(w, "<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == "PUT" && query.Get("uploadId") == "upload-1":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if number == s.failPart {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		size, err := decodeChunked(r.Body)
+		if err != nil || strconv.Itoa(size) != r.Header.Get("X-Amz-Decoded-Content-Length") {
+			http.Error(w, fmt.Sprintf("bad body: %d bytes, %v", size, err), http.StatusBadRequest)
+			return
+		}
+		s.parts[number] = size
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	case r.Method == "POST" && query.Get("uploadId") == "upload-1":
+		body, _ := io.ReadAll(r.Body)
+		s.complete = string(body)
+		io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == "DELETE" && query.Get("uploadId") == "upload-1":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// decodeChunked returns the size of the data of an aws-chunked body.
+func decodeChunked(body io.Reader) (int, error) {
+	r := bufio.NewReader(body)
+	total := 0
+	for {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(header, ";", 2)[0], 16, 64)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(io.Discard, r, size+2); err != nil {
+			return 0, err
+		}
+		if size == 0 {
+			return total, nil
+		}
+		total += int(size)
+	}
+}
+
+func TestUploadLarge(t *testing.T) {
+	s3 := &fakeS3{parts: map[int]int{}}
+	server := httptest.NewTLSServer(s3)
+	defer server.Close()
+	s := Signer{Service: "s3", Region: "us-east-1", Credentials: testCredentials}
+	endpoint := strings.TrimPrefix(server.URL, "https://")
+
+	body := strings.NewReader(strings.Repeat("x", minPartSize+10))
+	if err := s.UploadLarge(context.Background(), server.Client(), endpoint, "big object", body, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s3.parts[1] != minPartSize || s3.parts[2] != 10 || len(s3.parts) != 2 {
+		t.Errorf("got parts %v", s3.parts)
+	}
+	want := `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>&#34;etag-1&#34;</ETag></Part><Part><PartNumber>2</PartNumber><ETag>&#34;etag-2&#34;</ETag></Part></CompleteMultipartUpload>`
+	if s3.complete != want {
+		t.Errorf("got completion\n%s\nwant\n%s", s3.complete, want)
+	}
+	if s3.requests[0] != "POST /big object" {
+		t.Errorf("got requests %q", s3.requests)
+	}
+}
+
+func TestUploadPartsConcurrently(t *testing.T) {
+	s3 := &fakeS3{parts: map[int]int{}}
+	server := httptest.NewTLSServer(s3)
+	defer server.Close()
+	s := Signer{Service: "s3", Region: "us-east-1", Credentials: testCredentials}
+	u, err := s.CreateMultipartUpload(context.Background(), server.Client(), strings.TrimPrefix(server.URL, "https://"), "key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for number := 1; number <= 8; number++ {
+		wg.Add(1)
+		go func(number int) {
+			defer wg.Done()
+			if err := u.UploadPart(context.Background(), number, strings.NewReader("part"), 4); err != nil {
+				t.Error(err)
+			}
+		}(number)
+	}
+	wg.Wait()
+	if err := u.Complete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for number := 1; number <= 8; number++ {
+		if want := fmt.Sprintf("<Part><PartNumber>%d</PartNumber>", number); !strings.Contains(s3.complete, want) {
+			t.Errorf("part %d is missing from the completion\n%s", number, s3.complete)
+		}
+	}
+}
+
+func TestUploadLargeAbortsOnFailure(t *testing.T) {
+	s3 := &fakeS3{parts: map[int]int{}, failPart: 2}
+	server := httptest.NewTLSServer(s3)
+	defer server.Close()
+	s := Signer{Service: "s3", Region: "us-east-1", Credentials: testCredentials}
+	endpoint := strings.TrimPrefix(server.URL, "https://")
+
+	body := strings.NewReader(strings.Repeat("x", 2*minPartSize))
+	err := s.UploadLarge(context.Background(), server.Client(), endpoint, "key", body, minPartSize, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to upload part 2") {
+		t.Fatalf("got %v, want part 2 to fail", err)
+	}
+	if last := s3.requests[len(s3.requests)-1]; last != "DELETE /key" {
+		t.Errorf("got requests %q, want the upload aborted", s3.requests)
+	}
+}
+
+func TestCompleteReportsErrorBody(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<Error><Code>InvalidPart</Code><Message>One or more of the specified parts could not be found.</Message></Error>")
+	}))
+	defer server.Close()
+	u := &MultipartUpload{
+		Signer:   Signer{Service: "s3", Region: "us-east-1", Credentials: testCredentials},
+		Client:   server.Client(),
+		Endpoint: strings.TrimPrefix(server.URL, "https://"),
+		Key:      "key",
+		UploadID: "upload-1",
+		parts:    []completedPart{{PartNumber: 1, ETag: `"etag-1"`}},
+	}
+	if err := u.Complete(context.Background()); err == nil || !strings.Contains(err.Error(), "InvalidPart") {
+		t.Errorf("got %v, want the error in the 200 response", err)
+	}
+}
@@ -0,0 +1,162 @@
+package awssigner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longest validity AWS accepts for a presigned request
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// Presign returns rawURL with the signature in its query string, so that
+// whoever holds it can make the request without credentials until it
+// expires. S3 GET and PUT URLs leave the payload unsigned, so a PUT may
+// upload any body.
+func (s Signer) Presign(method, rawURL string, expires time.Duration) (string, error) {
+	return s.presignAt(time.Now(), method, rawURL, expires)
+}
+
+func (s Signer) presignAt(now time.Time, method, rawURL string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > maxPresignExpiry {
+		return "", fmt.Errorf("presigned URLs must expire within %s", maxPresignExpiry)
+	}
+	if len(s.RegionSet) > 0 {
+		return "", fmt.Errorf("presigned URLs are only signed with SigV4")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	creds, err := s.Credentials.Retrieve(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	// Time setup
+	t := now.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	algorithm := "AWS4-HMAC-SHA256"
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", date, s.Region, s.Service)
+
+	// The authentication parameters are signed along with the URL's own
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", creds.AccessKey+"/"+credentialScope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Build canonical request
+	path := u.Path
+	if s.Service != "s3" {
+		path = normalizePath(path)
+	}
+	escapedPath := uriEncode(path, false)
+	payloadHash := "UNSIGNED-PAYLOAD"
+	if s.Service != "s3" {
+		payloadHash = sha256Hex(nil)
+	}
+	canonicalHeaders, signedHeaders := buildCanonicalHeaders(map[string]string{"host": u.Host})
+	canonicalRequest := buildCanonicalRequest(method, canonicalURI(s.Service, escapedPath), buildCanonicalQueryString(query), canonicalHeaders, signedHeaders, payloadHash)
+
+	// Create string to sign
+	stringToSign := fmt.Sprintf("%s\n%s\n%s\n%s",
+		algorithm, amzDate, credentialScope, sha256Hex([]byte(canonicalRequest)),
+	)
+
+	// Calculate signature
+	signingKey := getSignatureKey(creds.SecretKey, date, s.Region, s.Service)
+	query.Set("X-Amz-Signature", hmacHex(signingKey, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s", u.Scheme, u.Host, escapedPath, buildCanonicalQueryString(query)), nil
+}
+
+// PresignedPost is an S3 upload form for browsers: a multipart/form-data
+// POST to URL with Fields, followed by the file in a field named "file".
+type PresignedPost struct {
+	URL    string
+	Fields map[string]string
+}
+
+// PresignPost returns a form that uploads one object to bucket until it
+// expires. A key ending in ${filename} allows any key with the preceding
+// prefix, S3 substituting the name of the uploaded file. Conditions are
+// added to the policy as they are, such as
+// []interface{}{"content-length-range", 0, 10 << 20} to limit the size or
+// map[string]string{"acl": "public-read"}; the caller adds the fields they
+// require to the form.
+func (s Signer) PresignPost(bucket, key string, expires time.Duration, conditions ...interface{}) (*PresignedPost, error) {
+	return s.presignPostAt(time.Now(), bucket, key, expires, conditions...)
+}
+
+func (s Signer) presignPostAt(now time.Time, bucket, key string, expires time.Duration, conditions ...interface{}) (*PresignedPost, error) {
+	if expires <= 0 || expires > maxPresignExpiry {
+		return nil, fmt.Errorf("presigned uploads must expire within %s", maxPresignExpiry)
+	}
+	if len(s.RegionSet) > 0 {
+		return nil, fmt.Errorf("presigned uploads are only signed with SigV4")
+	}
+	creds, err := s.Credentials.Retrieve(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	// Time setup
+	t := now.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	algorithm := "AWS4-HMAC-SHA256"
+	credential := fmt.Sprintf("%s/%s/%s/%s/aws4_request", creds.AccessKey, date, s.Region, s.Service)
+
+	fields := map[string]string{
+		"key":              key,
+		"x-amz-algorithm":  algorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       amzDate,
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+
+	// Build the policy document
+	policyConditions := []interface{}{map[string]string{"bucket": bucket}}
+	if prefix, ok := strings.CutSuffix(key, "${filename}"); ok {
+		policyConditions = append(policyConditions, []string{"starts-with", "$key", prefix})
+	} else {
+		policyConditions = append(policyConditions, map[string]string{"key": key})
+	}
+	for _, name := range []string{"x-amz-algorithm", "x-amz-credential", "x-amz-date", "x-amz-security-token"} {
+		if fields[name] == "" {
+			continue
+		}
+		policyConditions = append(policyConditions, map[string]string{name: fields[name]})
+	}
+	policyConditions = append(policyConditions, conditions...)
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": t.Add(expires).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": policyConditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy condition: %w", err)
+	}
+
+	// The base64 policy is the string to sign
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+	signingKey := getSignatureKey(creds.SecretKey, date, s.Region, s.Service)
+	fields["x-amz-signature"] = hmacHex(signingKey, fields["policy"])
+
+	return &PresignedPost{
+		URL:    fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucket, s.Region),
+		Fields: fields,
+	}, nil
+}
@@ -1,44 +1,134 @@
-package main
+// Package awssigner signs AWS requests with SigV4 and SigV4A, presigns S3
+// URLs and uploads, and verifies the signatures of incoming requests.
+package awssigner
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 )
 
+// Signer holds what every signature for one service in one region needs
+type Signer struct {
+	Service string
+	Region  string
+	// RegionSet switches to SigV4A, whose signatures are valid in each of
+	// these regions, or in all of them for "*", as S3 Multi-Region Access
+	// Points require. Region is then unused.
+	RegionSet   []string
+	Credentials CredentialsProvider
+}
+
+// Sign signs a request like SignAWSRequest with the signer's credentials,
+// adding X-Amz-Security-Token when they are temporary.
+func (s Signer) Sign(ctx context.Context, method, endpoint, path string, query map[string]string, payload []byte, headers map[string]string) (*http.Request, error) {
+	creds, err := s.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	if len(s.RegionSet) > 0 {
+		params := url.Values{}
+		for key, value := range query {
+			params.Set(key, value)
+		}
+		reqURL := fmt.Sprintf("https://%s%s", endpoint, uriEncode(path, false))
+		if len(params) > 0 {
+			reqURL += "?" + buildCanonicalQueryString(params)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, reqURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		payloadHash := sha256Hex(payload)
+		if s.Service == "s3" && len(payload) == 0 {
+			payloadHash = "UNSIGNED-PAYLOAD"
+		}
+		if err := s.signRequest(req, time.Now(), payloadHash, creds); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	if creds.SessionToken != "" {
+		withToken := make(map[string]string, len(headers)+1)
+		for key, value := range headers {
+			withToken[key] = value
+		}
+		withToken["X-Amz-Security-Token"] = creds.SessionToken
+		headers = withToken
+	}
+
+	req, err := signAWSRequestAt(time.Now(), method, s.Service, s.Region, endpoint, path, query, payload, headers, creds.AccessKey, creds.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// signRequest signs req in place with SigV4A when the signer has a region
+// set, and with SigV4 otherwise.
+func (s Signer) signRequest(req *http.Request, now time.Time, payloadHash string, creds Credentials) error {
+	if len(s.RegionSet) > 0 {
+		return signHTTPRequestV4A(req, now, s.Service, s.RegionSet, payloadHash, creds)
+	}
+	signHTTPRequest(req, now, s.Service, s.Region, payloadHash, creds)
+	return nil
+}
+
 // SignAWSRequest signs an AWS request for Lambda, S3, SES, or any other service
 func SignAWSRequest(method, service, region, endpoint, path string, query map[string]string, payload []byte, headers map[string]string, accessKey, secretKey string) (*http.Request, error) {
+	return signAWSRequestAt(time.Now(), method, service, region, endpoint, path, query, payload, headers, accessKey, secretKey)
+}
+
+// signAWSRequestAt signs a request as of the given time. The path is
+// unescaped; it is percent-encoded here, once for the URL and a second time
+// in the canonical request of services other than S3.
+func signAWSRequestAt(now time.Time, method, service, region, endpoint, path string, query map[string]string, payload []byte, headers map[string]string, accessKey, secretKey string) (*http.Request, error) {
 	// Time setup
-	t := time.Now().UTC()
+	t := now.UTC()
 	amzDate := t.Format("20060102T150405Z")
 	date := t.Format("20060102")
 
-	// Default headers
-	if headers == nil {
-		headers = make(map[string]string)
+	// Default headers, copied so that the caller's map is left alone
+	signed := make(map[string]string, len(headers)+3)
+	for key, value := range headers {
+		signed[key] = value
 	}
-	headers["x-amz-date"] = amzDate
-	if service == "s3" && len(payload) == 0 {
-		headers["x-amz-content-sha256"] = "UNSIGNED-PAYLOAD"
-	} else {
-		headers["x-amz-content-sha256"] = sha256Hex(payload)
+	signed["x-amz-date"] = amzDate
+	payloadHash := sha256Hex(payload)
+	if service == "s3" {
+		// Only S3 requires the payload hash in a header
+		if len(payload) == 0 {
+			payloadHash = "UNSIGNED-PAYLOAD"
+		}
+		signed["x-amz-content-sha256"] = payloadHash
 	}
-	headers["host"] = endpoint
+	signed["host"] = endpoint
 
 	// Build canonical request
-	canonicalURI := path
-	canonicalQueryString := buildCanonicalQueryString(query)
-	canonicalHeaders, signedHeaders := buildCanonicalHeaders(headers)
-	payloadHash := headers["x-amz-content-sha256"]
-	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
-		method, canonicalURI, canonicalQueryString, canonicalHeaders, signedHeaders, payloadHash,
-	)
+	if service != "s3" {
+		path = normalizePath(path)
+	}
+	escapedPath := uriEncode(path, false)
+	params := url.Values{}
+	for key, value := range query {
+		params.Set(key, value)
+	}
+	canonicalQueryString := buildCanonicalQueryString(params)
+	canonicalHeaders, signedHeaders := buildCanonicalHeaders(signed)
+	canonicalRequest := buildCanonicalRequest(method, canonicalURI(service, escapedPath), canonicalQueryString, canonicalHeaders, signedHeaders, payloadHash)
 
 	// Create string to sign
 	algorithm := "AWS4-HMAC-SHA256"
@@ -55,10 +145,10 @@ func SignAWSRequest(method, service, region, endpoint, path string, query map[st
 	authorizationHeader := fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
 		algorithm, accessKey, credentialScope, signedHeaders, signature,
 	)
-	headers["Authorization"] = authorizationHeader
+	signed["Authorization"] = authorizationHeader
 
-	// Construct URL
-	reqURL := fmt.Sprintf("https://%s%s", endpoint, canonicalURI)
+	// Construct URL, with the path and query encoded as they were signed
+	reqURL := fmt.Sprintf("https://%s%s", endpoint, escapedPath)
 	if canonicalQueryString != "" {
 		reqURL += "?" + canonicalQueryString
 	}
@@ -70,31 +160,178 @@ func SignAWSRequest(method, service, region, endpoint, path string, query map[st
 	}
 
 	// Add headers to request
-	for key, value := range headers {
+	for key, value := range signed {
 		req.Header.Set(key, value)
 	}
 
 	return req, nil
 }
 
-// Helper: Build canonical query string
-func buildCanonicalQueryString(query map[string]string) string {
-	params := url.Values{}
-	for key, value := range query {
-		params.Add(key, value)
+// signHTTPRequest signs req in place as of the given time, re-encoding its
+// path and query the way they are signed. It signs the host, the content
+// type and MD5 and every X-Amz-* header; proxies may change the others.
+func signHTTPRequest(req *http.Request, now time.Time, service, region, payloadHash string, creds Credentials) {
+	// Time setup
+	t := now.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	// Build canonical request
+	canonicalRequest, signedHeaders := canonicalHTTPRequest(req, amzDate, service, payloadHash, creds)
+
+	// Create string to sign
+	algorithm := "AWS4-HMAC-SHA256"
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := fmt.Sprintf("%s\n%s\n%s\n%s",
+		algorithm, amzDate, credentialScope, sha256Hex([]byte(canonicalRequest)),
+	)
+
+	// Calculate signature
+	signingKey := getSignatureKey(creds.SecretKey, date, region, service)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKey, credentialScope, signedHeaders, hmacHex(signingKey, stringToSign),
+	))
+}
+
+// canonicalHTTPRequest sets the headers every signature carries on req and
+// returns its canonical request and the names of the signed headers. SigV4
+// and SigV4A sign the same canonical request.
+func canonicalHTTPRequest(req *http.Request, amzDate, service, payloadHash string, creds Credentials) (string, string) {
+	// Default headers
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "content-md5" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+
+	// Build canonical request
+	canonicalPath := uriEncode(req.URL.Path, false)
+	req.URL.RawPath = canonicalPath
+	if service != "s3" {
+		canonicalPath = uriEncode(normalizePath(req.URL.Path), false)
+	}
+	canonicalQueryString := buildCanonicalQueryString(req.URL.Query())
+	req.URL.RawQuery = canonicalQueryString
+	canonicalHeaders, signedHeaders := buildCanonicalHeaders(headers)
+	return buildCanonicalRequest(req.Method, canonicalURI(service, canonicalPath), canonicalQueryString, canonicalHeaders, signedHeaders, payloadHash), signedHeaders
+}
+
+// Helper: Build the canonical request from its parts
+func buildCanonicalRequest(method, canonicalURI, canonicalQueryString, canonicalHeaders, signedHeaders, payloadHash string) string {
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
+		method, canonicalURI, canonicalQueryString, canonicalHeaders, signedHeaders, payloadHash,
+	)
+}
+
+// Helper: Canonical URI of an escaped path. S3 signs the path as sent;
+// every other service encodes it a second time.
+func canonicalURI(service, escapedPath string) string {
+	if escapedPath == "" {
+		return "/"
+	}
+	if service == "s3" {
+		return escapedPath
 	}
-	return params.Encode()
+	return uriEncode(escapedPath, false)
 }
 
-// Helper: Build canonical headers
+// Helper: Remove empty, "." and ".." segments from a path, as every service
+// but S3 does before checking a signature
+func normalizePath(p string) string {
+	var segments []string
+	for _, segment := range strings.Split(p, "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	normalized := "/" + strings.Join(segments, "/")
+	if len(segments) > 0 && (strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		normalized += "/"
+	}
+	return normalized
+}
+
+// Helper: Percent-encode everything but the RFC 3986 unreserved characters,
+// with uppercase hex digits, optionally leaving slashes alone
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0xF])
+		}
+	}
+	return b.String()
+}
+
+// Helper: Build canonical query string, sorted by encoded name and then by
+// encoded value
+func buildCanonicalQueryString(query url.Values) string {
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		ki, vi, _ := strings.Cut(params[i], "=")
+		kj, vj, _ := strings.Cut(params[j], "=")
+		if ki != kj {
+			return ki < kj
+		}
+		return vi < vj
+	})
+	return strings.Join(params, "&")
+}
+
+// Helper: Build canonical headers, with lowercase names in sorted order and
+// values trimmed and their runs of spaces collapsed. Names that differ only
+// in case are combined into one comma-separated header.
 func buildCanonicalHeaders(headers map[string]string) (string, string) {
-	var canonicalHeaders, signedHeaders strings.Builder
+	values := map[string][]string{}
 	for key, value := range headers {
-		key = strings.ToLower(key)
-		canonicalHeaders.WriteString(fmt.Sprintf("%s:%s\n", key, value))
-		signedHeaders.WriteString(key + ";")
+		key = strings.ToLower(strings.TrimSpace(key))
+		values[key] = append(values[key], strings.Join(strings.Fields(value), " "))
 	}
-	return canonicalHeaders.String(), strings.TrimSuffix(signedHeaders.String(), ";")
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+		sort.Strings(values[name])
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(values[name], ",") + "\n")
+	}
+	return canonicalHeaders.String(), strings.Join(names, ";")
 }
 
 // Helper: SHA256 hash
@@ -123,22 +360,20 @@ func getSignatureKey(key, date, region, service string) []byte {
 	return hmacSHA256(kService, "aws4_request")
 }
 
-// s3Req, err := SignAWSRequest(
-// 	"GET",
-// 	"s3",
-// 	"us-east-1",
-// 	"my-bucket.s3.amazonaws.com",
-// 	"/my-object-key",
-// 	map[string]string{"X-Amz-Expires": "3600"},
-// 	nil,
-// 	map[string]string{},
-// 	"AKIA...YOUR_ACCESS_KEY",
-// 	"YOUR_SECRET_KEY",
+// s3 := Signer{Service: "s3", Region: "us-east-1", Credentials: DefaultCredentials()}
+// presignedURL, err := s3.Presign("GET", "https://my-bucket.s3.amazonaws.com/my-object-key", time.Hour)
+// if err != nil {
+// 	log.Fatalf("Error presigning S3 request: %v", err)
+// }
+// fmt.Println("Presigned S3 URL:", presignedURL)
+
+// upload, err := s3.PresignPost("my-bucket", "uploads/${filename}", time.Hour,
+// 	[]interface{}{"content-length-range", 0, 10 << 20},
 // )
 // if err != nil {
-// 	log.Fatalf("Error signing S3 request: %v", err)
+// 	log.Fatalf("Error presigning S3 upload: %v", err)
 // }
-// fmt.Println("Presigned S3 URL:", s3Req.URL.String())
+// fmt.Println("Browser upload form:", upload.URL, upload.Fields)
 
 // lambdaPayload := []byte(`{"key":"value"}`)
 // lambdaReq, err := SignAWSRequest(
@@ -0,0 +1,134 @@
+package awssigner
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The AWS SigV4 test suite signs every request as of 20150830T123600Z for
+// service "service" in us-east-1 with these credentials.
+const (
+	suiteAccessKey = "AKIDEXAMPLE"
+	suiteSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	suiteHost      = "example.amazonaws.com"
+)
+
+var suiteTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+func TestSigV4Suite(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		query         map[string]string
+		headers       map[string]string
+		payload       string
+		signedHeaders string
+		signature     string
+	}{
+		{name: "get-vanilla", method: "GET", path: "/",
+			signedHeaders: "host;x-amz-date", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-vanilla-empty-query-key", method: "GET", path: "/", query: map[string]string{"Param1": "value1"},
+			signedHeaders: "host;x-amz-date", signature: "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb"},
+		{name: "get-vanilla-query-order-key-case", method: "GET", path: "/", query: map[string]string{"Param2": "value2", "Param1": "value1"},
+			signedHeaders: "host;x-amz-date", signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{name: "get-vanilla-query-unreserved", method: "GET", path: "/",
+			query:         map[string]string{"-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz": "-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"},
+			signedHeaders: "host;x-amz-date", signature: "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197"},
+		{name: "get-vanilla-utf8-query", method: "GET", path: "/", query: map[string]string{"ሴ": "bar"},
+			signedHeaders: "host;x-amz-date", signature: "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04"},
+		{name: "get-unreserved", method: "GET", path: "/-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			signedHeaders: "host;x-amz-date", signature: "07ef7494c76fa4850883e2b006601f940f8a34d404d0cfa977f52a65bbf5f24f"},
+		// The suite signs these paths encoded once, as S3 does; every other
+		// service signs them encoded twice, as here
+		{name: "get-utf8", method: "GET", path: "/ሴ",
+			signedHeaders: "host;x-amz-date", signature: "697b34846207a3f72246f99d74ae1ee4fe54f44bb06730c58a0d339eb079596d"},
+		{name: "get-space", method: "GET", path: "/example space/",
+			signedHeaders: "host;x-amz-date", signature: "446b817944c553435b35e813c261ff4e161fff982d1bacdef1c87f6785dd1662"},
+		{name: "get-header-value-trim", method: "GET", path: "/", headers: map[string]string{"My-Header1": " value1", "My-Header2": ` "a   b   c"`},
+			signedHeaders: "host;my-header1;my-header2;x-amz-date", signature: "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736"},
+		{name: "get-header-key-duplicate", method: "GET", path: "/", headers: map[string]string{"My-Header1": "value2,value2,value1"},
+			signedHeaders: "host;my-header1;x-amz-date", signature: "c9d5ea9f3f72853aea855b47ea873832890dbdd183b4468f858259531a5138ea"},
+		{name: "get-header-value-order", method: "GET", path: "/", headers: map[string]string{"My-Header1": "value4,value1,value3,value2"},
+			signedHeaders: "host;my-header1;x-amz-date", signature: "08c7e5a9acfcfeb3ab6b2185e75ce8b1deb5e634ec47601a50643f830c755c01"},
+		{name: "post-vanilla", method: "POST", path: "/",
+			signedHeaders: "host;x-amz-date", signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{name: "post-vanilla-query", method: "POST", path: "/", query: map[string]string{"Param1": "value1"},
+			signedHeaders: "host;x-amz-date", signature: "28038455d6de14eafc1f9222cf5aa6f1a96197d7deb8263271d420d138af7f11"},
+		{name: "post-header-key-sort", method: "POST", path: "/", headers: map[string]string{"My-Header1": "value1"},
+			signedHeaders: "host;my-header1;x-amz-date", signature: "c5410059b04c1ee005303aed430f6e6645f61f4dc9e1461ec8f8916fdf18852c"},
+		{name: "post-header-value-case", method: "POST", path: "/", headers: map[string]string{"My-Header1": "VALUE1"},
+			signedHeaders: "host;my-header1;x-amz-date", signature: "cdbc9802e29d2942e5e10b5bccfdd67c5f22c7c4e8ae67b53629efa58b974b7d"},
+		{name: "post-x-www-form-urlencoded", method: "POST", path: "/", headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, payload: "Param1=value1",
+			signedHeaders: "content-type;host;x-amz-date", signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+		{name: "post-x-www-form-urlencoded-parameters", method: "POST", path: "/", headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf8"}, payload: "Param1=value1",
+			signedHeaders: "content-type;host;x-amz-date", signature: "1a72ec8f64bd914b0e42e42607c7fbce7fb2c7465f63e3092b3b0d39fa77a6fe"},
+
+		// normalize-path
+		{name: "get-relative", method: "GET", path: "/example/..",
+			signedHeaders: "host;x-amz-date", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-relative-relative", method: "GET", path: "/example1/example2/../..",
+			signedHeaders: "host;x-amz-date", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-slash", method: "GET", path: "//",
+			signedHeaders: "host;x-amz-date", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-slash-dot-slash", method: "GET", path: "/./",
+			signedHeaders: "host;x-amz-date", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-slash-pointless-dot", method: "GET", path: "/./example",
+			signedHeaders: "host;x-amz-date", signature: "ef75d96142cf21edca26f06005da7988e4f8dc83a165a80865db7089db637ec5"},
+		{name: "get-slashes", method: "GET", path: "//example//",
+			signedHeaders: "host;x-amz-date", signature: "9a624bd73a37c9a373b5312afbebe7a714a789de108f0bdfe846570885f57e84"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := signAWSRequestAt(suiteTime, test.method, "service", "us-east-1", suiteHost, test.path, test.query, []byte(test.payload), test.headers, suiteAccessKey, suiteSecretKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=" + test.signedHeaders + ", Signature=" + test.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("got Authorization\n%s\nwant\n%s", got, want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("got X-Amz-Date %q", got)
+			}
+		})
+	}
+}
+
+func TestSignS3PayloadHash(t *testing.T) {
+	req, err := signAWSRequestAt(suiteTime, "GET", "s3", "us-east-1", "bucket.s3.amazonaws.com", "/a b/../key", nil, nil, nil, suiteAccessKey, suiteSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "UNSIGNED-PAYLOAD" {
+		t.Errorf("got X-Amz-Content-Sha256 %q, want UNSIGNED-PAYLOAD", got)
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date,") {
+		t.Errorf("got Authorization %q, want the payload hash signed", req.Header.Get("Authorization"))
+	}
+	// S3 keys are signed as they are, without normalizing the path
+	if got := req.URL.EscapedPath(); got != "/a%20b/../key" {
+		t.Errorf("got path %q", got)
+	}
+}
+
+func TestSignRegionSetQuery(t *testing.T) {
+	s := Signer{Service: "s3", RegionSet: []string{"*"}, Credentials: StaticProvider{Credentials{AccessKey: suiteAccessKey, SecretKey: suiteSecretKey}}}
+	req, err := s.Sign(context.Background(), "GET", "mrap.accesspoint.s3-global.amazonaws.com", "/key", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.String(); got != "https://mrap.accesspoint.s3-global.amazonaws.com/key" {
+		t.Errorf("got URL %q, want no query", got)
+	}
+
+	req, err = s.Sign(context.Background(), "GET", "mrap.accesspoint.s3-global.amazonaws.com", "/key", map[string]string{"versionId": "a b"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.RawQuery; got != "versionId=a%20b" {
+		t.Errorf("got query %q", got)
+	}
+}
@@ -0,0 +1,107 @@
+package awssigner
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// signHTTPRequestV4A signs req in place with SigV4A: the canonical request
+// of SigV4, scoped to a set of regions and signed with an ECDSA P-256 key
+// derived from the secret key.
+func signHTTPRequestV4A(req *http.Request, now time.Time, service string, regionSet []string, payloadHash string, creds Credentials) error {
+	// Time setup
+	t := now.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	// Build canonical request, which signs the region set
+	req.Header.Set("X-Amz-Region-Set", strings.Join(regionSet, ","))
+	canonicalRequest, signedHeaders := canonicalHTTPRequest(req, amzDate, service, payloadHash, creds)
+
+	// Create string to sign; the scope has no region
+	algorithm := "AWS4-ECDSA-P256-SHA256"
+	credentialScope := fmt.Sprintf("%s/%s/aws4_request", date, service)
+	stringToSign := fmt.Sprintf("%s\n%s\n%s\n%s",
+		algorithm, amzDate, credentialScope, sha256Hex([]byte(canonicalRequest)),
+	)
+
+	// Calculate signature
+	key, err := deriveV4AKey(creds.AccessKey, creds.SecretKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKey, credentialScope, signedHeaders, hex.EncodeToString(signature),
+	))
+	return nil
+}
+
+// deriveV4AKey derives the ECDSA key of a key pair: the first candidate of
+// an HMAC-SHA256 counter-mode KDF (NIST SP 800-108) over the access key
+// that is below n-2, plus one.
+func deriveV4AKey(accessKey, secretKey string) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	nMinusTwo := new(big.Int).Sub(curve.Params().N, big.NewInt(2))
+	inputKey := []byte("AWS4A" + secretKey)
+
+	for counter := 1; counter <= 0xFF; counter++ {
+		kdfContext := append([]byte(accessKey), byte(counter))
+		candidate := new(big.Int).SetBytes(kdfCounterMode(inputKey, []byte("AWS4-ECDSA-P256-SHA256"), kdfContext, 256))
+		if candidate.Cmp(nMinusTwo) >= 0 {
+			continue
+		}
+
+		d := candidate.Add(candidate, big.NewInt(1))
+		ecdhKey, err := ecdh.P256().NewPrivateKey(d.FillBytes(make([]byte, 32)))
+		if err != nil {
+			return nil, err
+		}
+		// The public key is 0x04 followed by X and Y
+		public := ecdhKey.PublicKey().Bytes()
+		return &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: d,
+		}, nil
+	}
+	return nil, errors.New("failed to derive a SigV4A key")
+}
+
+// Helper: HMAC-SHA256 key derivation in counter mode, producing bits bits
+func kdfCounterMode(key, label, context []byte, bits int) []byte {
+	var out []byte
+	buf := make([]byte, 4)
+	for i := uint32(1); len(out) < bits/8; i++ {
+		h := hmac.New(sha256.New, key)
+		binary.BigEndian.PutUint32(buf, i)
+		h.Write(buf)
+		h.Write(label)
+		h.Write([]byte{0})
+		h.Write(context)
+		binary.BigEndian.PutUint32(buf, uint32(bits))
+		h.Write(buf)
+		out = h.Sum(out)
+	}
+	return out[:bits/8]
+}
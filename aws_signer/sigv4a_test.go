@@ -0,0 +1,84 @@
+package awssigner
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeriveV4AKey(t *testing.T) {
+	// Cross-checked with the key derivation of the AWS SDK for Go v2
+	tests := []struct {
+		accessKey, secretKey string
+		d, x, y              string
+	}{
+		{
+			accessKey: "AKISORANDOMAASORANDOM",
+			secretKey: "q+jcrXGc+0zWN6uzclKVhvMmUsIfRPa4rlRandom",
+			d:         "7FD3BD010C0D9C292141C2B77BFBDE1042C92E6836FFF749D1269EC890FCA1BD",
+			x:         "15D242CEEBF8D8169FD6A8B5A746C41140414C3B07579038DA06AF89190FFFCB",
+			y:         "515242CEDD82E94799482E4C0514B505AFCCF2C0C98D6A553BF539F424C5EC0",
+		},
+		{
+			accessKey: suiteAccessKey,
+			secretKey: suiteSecretKey,
+			d:         "7EFC8C0E65A324242818C5A50C891C6060B6A00717B7BA3CBE3C5D765BE9259C",
+			x:         "B6618F6A65740A99E650B33B6B4B5BD0D43B176D721A3EDFEA7E7D2D56D936B1",
+			y:         "865ED22A7EADC9C5CB9D2CBACA1B3699139FEDC5043DC6661864218330C8E518",
+		},
+	}
+	for _, test := range tests {
+		key, err := deriveV4AKey(test.accessKey, test.secretKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%X", key.D); got != test.d {
+			t.Errorf("%s: got D %s, want %s", test.accessKey, got, test.d)
+		}
+		if got := fmt.Sprintf("%X %X", key.X, key.Y); got != test.x+" "+test.y {
+			t.Errorf("%s: got public key %s, want %s %s", test.accessKey, got, test.x, test.y)
+		}
+	}
+}
+
+func TestSignHTTPRequestV4A(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := Credentials{AccessKey: suiteAccessKey, SecretKey: suiteSecretKey}
+	if err := signHTTPRequestV4A(req, suiteTime, "service", []string{"us-east-1", "eu-west-1"}, sha256Hex(nil), creds); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "AWS4-ECDSA-P256-SHA256 Credential=AKIDEXAMPLE/20150830/service/aws4_request, SignedHeaders=host;x-amz-date;x-amz-region-set, Signature="
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, prefix) {
+		t.Fatalf("got Authorization %q", authorization)
+	}
+	if got := req.Header.Get("X-Amz-Region-Set"); got != "us-east-1,eu-west-1" {
+		t.Errorf("got X-Amz-Region-Set %q", got)
+	}
+
+	// ECDSA signatures are random, so check it against the public key
+	canonicalRequest := "GET\n/\n\n" +
+		"host:example.amazonaws.com\nx-amz-date:20150830T123600Z\nx-amz-region-set:us-east-1,eu-west-1\n\n" +
+		"host;x-amz-date;x-amz-region-set\n" + sha256Hex(nil)
+	stringToSign := "AWS4-ECDSA-P256-SHA256\n20150830T123600Z\n20150830/service/aws4_request\n" + sha256Hex([]byte(canonicalRequest))
+	signature, err := hex.DecodeString(strings.TrimPrefix(authorization, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := deriveV4AKey(creds.AccessKey, creds.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(stringToSign))
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Error("signature does not verify against the canonical request")
+	}
+}
@@ -0,0 +1,141 @@
+package awssigner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Transport is an http.RoundTripper that signs every request with Signer,
+// so that a plain http.Client can call AWS:
+//
+//	client := &http.Client{Transport: &Transport{Signer: Signer{
+//		Service: "lambda", Region: "us-east-1", Credentials: DefaultCredentials(),
+//	}}}
+//
+// Bodies are hashed from GetBody without buffering them. S3 bodies without
+// GetBody are streamed as UNSIGNED-PAYLOAD, and other services' are read
+// into memory to be hashed. A caller that sets X-Amz-Content-Sha256 has the
+// payload signed as that.
+type Transport struct {
+	Signer Signer
+	// Base sends the signed requests, http.DefaultTransport by default
+	Base http.RoundTripper
+
+	mu sync.Mutex
+	// skew is how far AWS's clock is ahead of ours
+	skew time.Duration
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	creds, err := t.Signer.Credentials.Retrieve(req.Context())
+	if err != nil {
+		closeBody(req)
+		return nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+	payloadHash, signed, err := t.prepare(req)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	if err := t.Signer.signRequest(signed, time.Now().Add(t.clockSkew()), payloadHash, creds); err != nil {
+		closeBody(signed)
+		return nil, err
+	}
+	resp, err := base.RoundTrip(signed)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+
+	// AWS rejects signatures more than a few minutes from its own clock, so
+	// correct ours by its Date header and try once more
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return resp, nil
+	}
+	skew := time.Until(serverTime)
+	if previous := t.clockSkew(); skew-previous < time.Minute && previous-skew < time.Minute {
+		return resp, nil
+	}
+	t.mu.Lock()
+	t.skew = skew
+	t.mu.Unlock()
+	if signed.Body != nil && signed.GetBody == nil {
+		return resp, nil
+	}
+
+	retry := signed.Clone(req.Context())
+	if signed.GetBody != nil {
+		if retry.Body, err = signed.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	if err := t.Signer.signRequest(retry, time.Now().Add(skew), payloadHash, creds); err != nil {
+		closeBody(retry)
+		return resp, nil
+	}
+	resp.Body.Close()
+	return base.RoundTrip(retry)
+}
+
+func (t *Transport) clockSkew() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.skew
+}
+
+// prepare returns the payload hash and a copy of req to sign, whose body is
+// buffered when it has to be hashed and can't be read twice.
+func (t *Transport) prepare(req *http.Request) (string, *http.Request, error) {
+	signed := req.Clone(req.Context())
+	if hash := req.Header.Get("X-Amz-Content-Sha256"); hash != "" {
+		return hash, signed, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return sha256Hex(nil), signed, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read body: %w", err)
+		}
+		defer body.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", nil, fmt.Errorf("failed to hash body: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), signed, nil
+	}
+
+	if t.Signer.Service == "s3" {
+		return "UNSIGNED-PAYLOAD", signed, nil
+	}
+	payload, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	signed.Body = io.NopCloser(bytes.NewReader(payload))
+	signed.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(payload)), nil
+	}
+	return sha256Hex(payload), signed, nil
+}
+
+// Helper: Close the body of a request that won't be sent, as RoundTrip must
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,133 @@
+package awssigner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) SecretKey(ctx context.Context, accessKey string) (string, error) {
+	if secretKey, ok := s[accessKey]; ok {
+		return secretKey, nil
+	}
+	return "", errors.New("no such access key")
+}
+
+var testCredentials = StaticProvider{Credentials{AccessKey: "AKID", SecretKey: "SECRET"}}
+
+// echoServer verifies requests signed for service in us-east-1 and echoes
+// their bodies and payload hash headers.
+func echoServer(t *testing.T, service string) *httptest.Server {
+	t.Helper()
+	v := &Verifier{Service: service, Region: "us-east-1", Secrets: staticSecrets{"AKID": "SECRET"}, AllowUnsignedPayload: true}
+	server := httptest.NewServer(v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Payload-Hash", r.Header.Get("X-Amz-Content-Sha256"))
+		w.Write(body)
+	})))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		body     func() io.Reader
+		header   string
+		wantHash string
+	}{
+		{name: "no body", service: "execute-api", body: func() io.Reader { return nil }},
+		{name: "rewindable body", service: "execute-api", body: func() io.Reader { return strings.NewReader("hello") }},
+		{name: "buffered body", service: "execute-api", body: func() io.Reader { return io.NopCloser(strings.NewReader("hello")) }},
+		{name: "s3 rewindable body", service: "s3", body: func() io.Reader { return strings.NewReader("hello") },
+			wantHash: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{name: "s3 streamed body", service: "s3", body: func() io.Reader { return io.NopCloser(strings.NewReader("hello")) },
+			wantHash: "UNSIGNED-PAYLOAD"},
+		{name: "caller's payload hash", service: "s3", body: func() io.Reader { return io.NopCloser(strings.NewReader("hello")) },
+			header: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", wantHash: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := echoServer(t, test.service)
+			client := &http.Client{Transport: &Transport{Signer: Signer{Service: test.service, Region: "us-east-1", Credentials: testCredentials}}}
+
+			body := test.body()
+			req, err := http.NewRequest("PUT", server.URL+"/a b/../key", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.header != "" {
+				req.Header.Set("X-Amz-Content-Sha256", test.header)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got %s: %s", resp.Status, got)
+			}
+			if want := map[bool]string{true: "hello", false: ""}[body != nil]; string(got) != want {
+				t.Errorf("got body %q, want %q", got, want)
+			}
+			if hash := resp.Header.Get("X-Payload-Hash"); hash != test.wantHash {
+				t.Errorf("got X-Amz-Content-Sha256 %q, want %q", hash, test.wantHash)
+			}
+			// The caller's request is left unsigned
+			if req.Header.Get("Authorization") != "" {
+				t.Error("the caller's request was modified")
+			}
+		})
+	}
+}
+
+func TestTransportCorrectsClockSkew(t *testing.T) {
+	serverTime := time.Now().Add(time.Hour).UTC()
+	var mu sync.Mutex
+	var dates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		dates = append(dates, r.Header.Get("X-Amz-Date")+" "+string(body))
+		mu.Unlock()
+		signedAt, _ := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if d := serverTime.Sub(signedAt); d > 5*time.Minute || d < -5*time.Minute {
+			w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &Transport{Signer: Signer{Service: "execute-api", Region: "us-east-1", Credentials: testCredentials}}}
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %s after correcting the clock", resp.Status)
+	}
+	if len(dates) != 2 || !strings.HasSuffix(dates[1], " hello") {
+		t.Errorf("got requests %q, want a retry with the body", dates)
+	}
+
+	// Later requests are signed with the corrected clock straight away
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(dates) != 3 {
+		t.Errorf("got %s after %d requests", resp.Status, len(dates))
+	}
+}
@@ -0,0 +1,373 @@
+package awssigner
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretStore looks up the secret key of an access key, returning an error
+// for unknown keys.
+type SecretStore interface {
+	SecretKey(ctx context.Context, accessKey string) (string, error)
+}
+
+// Verifier checks SigV4 and SigV4A signatures made for one service and
+// region, in the Authorization header or in a presigned query.
+type Verifier struct {
+	Service string
+	Region  string
+	Secrets SecretStore
+	// MaxSkew is how far a request's date may be from the server's, 15
+	// minutes by default as on AWS
+	MaxSkew time.Duration
+	// MaxBodySize caps the bodies read to check their hash, 10 MiB by
+	// default
+	MaxBodySize int64
+	// AllowUnsignedPayload accepts UNSIGNED-PAYLOAD, leaving the body
+	// unchecked
+	AllowUnsignedPayload bool
+
+	mu sync.Mutex
+	// seen holds the hashes of the strings to sign of recent requests to
+	// reject replays. Hex case and ECDSA signatures can vary for the same
+	// request, but what they sign can't.
+	seen map[string]time.Time
+}
+
+type accessKeyContextKey struct{}
+
+// AccessKeyFromContext returns the access key a verified request was
+// signed with.
+func AccessKeyFromContext(ctx context.Context) (string, bool) {
+	accessKey, ok := ctx.Value(accessKeyContextKey{}).(string)
+	return accessKey, ok
+}
+
+// Middleware passes verified requests to next, with their access key in the
+// context, and rejects the others with 403 Forbidden without saying why.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessKey, err := v.Verify(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessKeyContextKey{}, accessKey)))
+	})
+}
+
+// signedRequest is what a signature claims about its request.
+type signedRequest struct {
+	algorithm     string
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	amzDate       string
+	signedHeaders string
+	signature     string
+	payloadHash   string
+	presigned     bool
+}
+
+// Verify checks the signature of r and returns its access key. Requests
+// signed in the header are accepted once; presigned URLs may be reused
+// until they expire.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	maxSkew := v.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 15 * time.Minute
+	}
+
+	var s *signedRequest
+	var err error
+	if r.URL.Query().Has("X-Amz-Signature") {
+		s, err = v.parsePresigned(r)
+	} else {
+		s, err = v.parseAuthorization(r)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Check the scope
+	if s.service != v.Service {
+		return "", fmt.Errorf("signature is for service %q", s.service)
+	}
+	if s.algorithm == "AWS4-HMAC-SHA256" && s.region != v.Region {
+		return "", fmt.Errorf("signature is for region %q", s.region)
+	}
+	if s.algorithm == "AWS4-ECDSA-P256-SHA256" && !regionSetIncludes(v.regionSet(r, s), v.Region) {
+		return "", fmt.Errorf("signature is not valid in region %q", v.Region)
+	}
+
+	// Check the date window
+	signedAt, err := time.Parse("20060102T150405Z", s.amzDate)
+	if err != nil || signedAt.Format("20060102") != s.date {
+		return "", errors.New("invalid or mismatched X-Amz-Date")
+	}
+	if s.presigned {
+		expires, err := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+		if err != nil || expires <= 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+			return "", errors.New("invalid X-Amz-Expires")
+		}
+		if time.Now().After(signedAt.Add(time.Duration(expires) * time.Second)) {
+			return "", errors.New("presigned URL has expired")
+		}
+		if signedAt.After(time.Now().Add(maxSkew)) {
+			return "", errors.New("request date is too far in the future")
+		}
+	} else if d := time.Since(signedAt); d > maxSkew || d < -maxSkew {
+		return "", errors.New("request date is too far from the server's time")
+	}
+
+	if err := v.checkPayload(r, s); err != nil {
+		return "", err
+	}
+
+	// Recompute the signature
+	secretKey, err := v.Secrets.SecretKey(r.Context(), s.accessKey)
+	if err != nil {
+		return "", fmt.Errorf("unknown access key: %w", err)
+	}
+	canonicalRequest, err := verifiedCanonicalRequest(r, s)
+	if err != nil {
+		return "", err
+	}
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", s.date, s.region, s.service)
+	if s.algorithm == "AWS4-ECDSA-P256-SHA256" {
+		credentialScope = fmt.Sprintf("%s/%s/aws4_request", s.date, s.service)
+	}
+	stringToSign := fmt.Sprintf("%s\n%s\n%s\n%s",
+		s.algorithm, s.amzDate, credentialScope, sha256Hex([]byte(canonicalRequest)),
+	)
+	if !verifySignature(s, secretKey, stringToSign) {
+		return "", errors.New("signature does not match")
+	}
+
+	if !s.presigned && !v.remember(sha256Hex([]byte(s.accessKey+"\n"+stringToSign)), signedAt, maxSkew) {
+		return "", errors.New("request has already been received")
+	}
+	return s.accessKey, nil
+}
+
+// parseAuthorization reads the signature from the Authorization header:
+// <algorithm> Credential=<key>/<scope>, SignedHeaders=<names>, Signature=<hex>
+func (v *Verifier) parseAuthorization(r *http.Request) (*signedRequest, error) {
+	algorithm, params, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok {
+		return nil, errors.New("missing or malformed Authorization header")
+	}
+	fields := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok {
+			fields[key] = value
+		}
+	}
+
+	s := &signedRequest{
+		algorithm:     algorithm,
+		amzDate:       r.Header.Get("X-Amz-Date"),
+		signedHeaders: fields["SignedHeaders"],
+		signature:     fields["Signature"],
+		payloadHash:   r.Header.Get("X-Amz-Content-Sha256"),
+	}
+	if err := s.parseCredential(fields["Credential"]); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(";"+s.signedHeaders+";", ";x-amz-date;") {
+		return nil, errors.New("X-Amz-Date is not signed")
+	}
+	// Otherwise the regions of a SigV4A signature could be widened
+	if s.algorithm == "AWS4-ECDSA-P256-SHA256" && !strings.Contains(";"+s.signedHeaders+";", ";x-amz-region-set;") {
+		return nil, errors.New("X-Amz-Region-Set is not signed")
+	}
+	return s, nil
+}
+
+// parsePresigned reads the signature from the X-Amz-* query parameters.
+func (v *Verifier) parsePresigned(r *http.Request) (*signedRequest, error) {
+	query := r.URL.Query()
+	s := &signedRequest{
+		algorithm:     query.Get("X-Amz-Algorithm"),
+		amzDate:       query.Get("X-Amz-Date"),
+		signedHeaders: query.Get("X-Amz-SignedHeaders"),
+		signature:     query.Get("X-Amz-Signature"),
+		presigned:     true,
+	}
+	if err := s.parseCredential(query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+	// Presign signs no payload
+	s.payloadHash = sha256Hex(nil)
+	if s.service == "s3" {
+		s.payloadHash = "UNSIGNED-PAYLOAD"
+	}
+	return s, nil
+}
+
+// parseCredential reads <key>/<date>/<region>/<service>/aws4_request, or
+// <key>/<date>/<service>/aws4_request for SigV4A.
+func (s *signedRequest) parseCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	switch {
+	case s.algorithm == "AWS4-HMAC-SHA256" && len(parts) == 5 && parts[4] == "aws4_request":
+		s.accessKey, s.date, s.region, s.service = parts[0], parts[1], parts[2], parts[3]
+	case s.algorithm == "AWS4-ECDSA-P256-SHA256" && len(parts) == 4 && parts[3] == "aws4_request":
+		s.accessKey, s.date, s.service = parts[0], parts[1], parts[2]
+	default:
+		return fmt.Errorf("unsupported algorithm %q or malformed credential", s.algorithm)
+	}
+	if s.signedHeaders == "" || s.signature == "" {
+		return errors.New("missing signed headers or signature")
+	}
+	return nil
+}
+
+// regionSet returns the regions a SigV4A signature is valid in, which the
+// signature covers: presigned URLs sign their whole query, and
+// parseAuthorization refuses an unsigned header.
+func (v *Verifier) regionSet(r *http.Request, s *signedRequest) string {
+	if s.presigned {
+		return r.URL.Query().Get("X-Amz-Region-Set")
+	}
+	return r.Header.Get("X-Amz-Region-Set")
+}
+
+// checkPayload compares the body with the hash it was signed with, reading
+// it into memory and putting it back for the handler.
+func (v *Verifier) checkPayload(r *http.Request, s *signedRequest) error {
+	switch {
+	case s.payloadHash == "UNSIGNED-PAYLOAD":
+		if !v.AllowUnsignedPayload && !s.presigned {
+			return errors.New("unsigned payloads are not accepted")
+		}
+		return nil
+	case strings.HasPrefix(s.payloadHash, "STREAMING-"):
+		return errors.New("streaming payloads are not accepted")
+	}
+
+	maxBodySize := v.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = 10 << 20
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		if int64(len(body)) > maxBodySize {
+			return errors.New("body is too large to verify")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	hash := sha256Hex(body)
+	if s.payloadHash == "" {
+		// Services other than S3 don't require the header
+		s.payloadHash = hash
+	}
+	if s.payloadHash != hash {
+		return errors.New("body does not match X-Amz-Content-Sha256")
+	}
+	return nil
+}
+
+// remember records the key of a request, returning false if it was already
+// seen. Keys are forgotten once their date leaves the window.
+func (v *Verifier) remember(key string, signedAt time.Time, maxSkew time.Duration) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.seen == nil {
+		v.seen = map[string]time.Time{}
+	}
+	for seen, at := range v.seen {
+		if time.Since(at) > maxSkew {
+			delete(v.seen, seen)
+		}
+	}
+	if _, ok := v.seen[key]; ok {
+		return false
+	}
+	v.seen[key] = signedAt
+	return true
+}
+
+// verifiedCanonicalRequest rebuilds the canonical request of r the way the
+// signer built it.
+func verifiedCanonicalRequest(r *http.Request, s *signedRequest) (string, error) {
+	headers := map[string]string{}
+	for _, name := range strings.Split(s.signedHeaders, ";") {
+		if name == "host" {
+			headers[name] = r.Host
+			continue
+		}
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			return "", fmt.Errorf("signed header %s is missing", name)
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+	if _, ok := headers["host"]; !ok {
+		return "", errors.New("host is not signed")
+	}
+	canonicalHeaders, signedHeaders := buildCanonicalHeaders(headers)
+	if signedHeaders != s.signedHeaders {
+		return "", errors.New("signed headers are not in canonical order")
+	}
+
+	path := r.URL.Path
+	if s.service != "s3" {
+		path = normalizePath(path)
+	}
+	query := r.URL.Query()
+	query.Del("X-Amz-Signature")
+	return buildCanonicalRequest(r.Method, canonicalURI(s.service, uriEncode(path, false)), buildCanonicalQueryString(query), canonicalHeaders, signedHeaders, s.payloadHash), nil
+}
+
+// verifySignature checks an HMAC signature against the derived signing key,
+// or an ECDSA one against the public key derived from the secret key.
+func verifySignature(s *signedRequest, secretKey, stringToSign string) bool {
+	signature, err := hex.DecodeString(s.signature)
+	if err != nil {
+		return false
+	}
+	if s.algorithm == "AWS4-ECDSA-P256-SHA256" {
+		key, err := deriveV4AKey(s.accessKey, secretKey)
+		if err != nil {
+			return false
+		}
+		digest := sha256.Sum256([]byte(stringToSign))
+		return ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature)
+	}
+	signingKey := getSignatureKey(secretKey, s.date, s.region, s.service)
+	return hmac.Equal(signature, hmacSHA256(signingKey, stringToSign))
+}
+
+// Helper: Whether a comma-separated region set includes a region, where "*"
+// includes every region
+func regionSetIncludes(regionSet, region string) bool {
+	for _, r := range strings.Split(regionSet, ",") {
+		r = strings.TrimSpace(r)
+		if r == "*" || r == region {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+package awssigner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifierServer serves requests verified for execute-api in us-east-1,
+// answering with their access key and body.
+func verifierServer(t *testing.T, v *Verifier) (*httptest.Server, string) {
+	t.Helper()
+	if v == nil {
+		v = &Verifier{Service: "execute-api", Region: "us-east-1", Secrets: staticSecrets{"AKID": "SECRET"}}
+	}
+	server := httptest.NewServer(v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessKey, _ := AccessKeyFromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, accessKey+" "+string(body))
+	})))
+	t.Cleanup(server.Close)
+	return server, strings.TrimPrefix(server.URL, "http://")
+}
+
+// send sends a request signed for https to the plain HTTP test server,
+// returning the status and body of the response.
+func send(t *testing.T, req *http.Request) (int, string) {
+	t.Helper()
+	req.URL.Scheme = "http"
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func signAt(t *testing.T, now time.Time, host, region, secretKey string, payload string) *http.Request {
+	t.Helper()
+	req, err := signAWSRequestAt(now, "POST", "execute-api", region, host, "/items/a b", map[string]string{"q": "1 2"}, []byte(payload), map[string]string{"Content-Type": "text/plain"}, "AKID", secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// resend copies a sent request with a fresh body.
+func resend(req *http.Request, payload string) *http.Request {
+	again := req.Clone(context.Background())
+	again.Body = io.NopCloser(strings.NewReader(payload))
+	return again
+}
+
+func TestVerifier(t *testing.T) {
+	_, host := verifierServer(t, nil)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		req    func() *http.Request
+		status int
+		body   string
+	}{
+		{name: "valid", req: func() *http.Request { return signAt(t, now, host, "us-east-1", "SECRET", "hello") },
+			status: http.StatusOK, body: "AKID hello"},
+		{name: "tampered body", req: func() *http.Request { return resend(signAt(t, now, host, "us-east-1", "SECRET", "hello"), "HELLO") },
+			status: http.StatusForbidden},
+		{name: "wrong region", req: func() *http.Request { return signAt(t, now, host, "eu-west-1", "SECRET", "a") },
+			status: http.StatusForbidden},
+		{name: "wrong secret", req: func() *http.Request { return signAt(t, now, host, "us-east-1", "WRONG", "b") },
+			status: http.StatusForbidden},
+		{name: "unsigned", req: func() *http.Request {
+			req := signAt(t, now, host, "us-east-1", "SECRET", "c")
+			req.Header.Del("Authorization")
+			return req
+		}, status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := send(t, test.req())
+			if status != test.status {
+				t.Fatalf("got %d %q, want %d", status, body, test.status)
+			}
+			// Rejections don't tell the client why
+			if test.status == http.StatusForbidden {
+				test.body = "Forbidden\n"
+			}
+			if body != test.body {
+				t.Errorf("got body %q, want %q", body, test.body)
+			}
+		})
+	}
+}
+
+func TestVerifierRejectsReplays(t *testing.T) {
+	_, host := verifierServer(t, nil)
+	req := signAt(t, time.Now(), host, "us-east-1", "SECRET", "hello")
+	if status, body := send(t, resend(req, "hello")); status != http.StatusOK {
+		t.Fatalf("got %d %q", status, body)
+	}
+	if status, _ := send(t, resend(req, "hello")); status != http.StatusForbidden {
+		t.Errorf("got %d for a replay", status)
+	}
+
+	// The same signature in uppercase hex is the same request
+	upper := resend(req, "hello")
+	authorization, signature, _ := strings.Cut(upper.Header.Get("Authorization"), "Signature=")
+	upper.Header.Set("Authorization", authorization+"Signature="+strings.ToUpper(signature))
+	acceptedByFreshVerifier(t, upper)
+	if status, _ := send(t, upper); status != http.StatusForbidden {
+		t.Errorf("got %d for a replay in uppercase hex", status)
+	}
+}
+
+func TestVerifierRejectsMalleatedV4AReplays(t *testing.T) {
+	server, _ := verifierServer(t, nil)
+	s := Signer{Service: "execute-api", RegionSet: []string{"us-east-1"}, Credentials: testCredentials}
+	client := &http.Client{Transport: &Transport{Signer: s}}
+	var sent *http.Request
+	client.Transport.(*Transport).Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req.Clone(context.Background())
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	resp, err := client.Post(server.URL+"/items", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %s", resp.Status)
+	}
+
+	// (r, n-s) is a second valid signature of the same request
+	authorization, signature, _ := strings.Cut(sent.Header.Get("Authorization"), "Signature=")
+	der, err := hex.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		t.Fatal(err)
+	}
+	rs.S.Sub(elliptic.P256().Params().N, rs.S)
+	malleated, err := asn1.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := resend(sent, "hello")
+	replay.Header.Set("Authorization", authorization+"Signature="+hex.EncodeToString(malleated))
+	acceptedByFreshVerifier(t, replay)
+	if status, _ := send(t, replay); status != http.StatusForbidden {
+		t.Errorf("got %d for a replay with a malleated signature", status)
+	}
+}
+
+func TestVerifierRequiresSignedRegionSet(t *testing.T) {
+	// A valid SigV4A signature that leaves the region set out, which anyone
+	// could then change
+	req, err := http.NewRequest("POST", "https://example.com/items", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := testCredentials.Credentials
+	amzDate := time.Now().UTC().Format("20060102T150405Z")
+	canonicalRequest, signedHeaders := canonicalHTTPRequest(req, amzDate, "execute-api", sha256Hex([]byte("hello")), creds)
+	credentialScope := amzDate[:8] + "/execute-api/aws4_request"
+	key, err := deriveV4AKey(creds.AccessKey, creds.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("AWS4-ECDSA-P256-SHA256\n" + amzDate + "\n" + credentialScope + "\n" + sha256Hex([]byte(canonicalRequest))))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-ECDSA-P256-SHA256 Credential=AKID/%s, SignedHeaders=%s, Signature=%x", credentialScope, signedHeaders, signature))
+	req.Header.Set("X-Amz-Region-Set", "*")
+
+	v := &Verifier{Service: "execute-api", Region: "us-east-1", Secrets: staticSecrets{"AKID": "SECRET"}}
+	if _, err := v.Verify(req); err == nil || !strings.Contains(err.Error(), "X-Amz-Region-Set is not signed") {
+		t.Errorf("got %v, want an unsigned region set to be refused", err)
+	}
+}
+
+// acceptedByFreshVerifier checks that a replayed request is only rejected
+// as a replay: a verifier that hasn't seen it accepts it.
+func acceptedByFreshVerifier(t *testing.T, req *http.Request) {
+	t.Helper()
+	fresh := req.Clone(context.Background())
+	fresh.Host = fresh.URL.Host
+	fresh.Body = io.NopCloser(strings.NewReader("hello"))
+	v := &Verifier{Service: "execute-api", Region: "us-east-1", Secrets: staticSecrets{"AKID": "SECRET"}}
+	if _, err := v.Verify(fresh); err != nil {
+		t.Fatalf("the replayed request doesn't verify: %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestVerifierClockSkew(t *testing.T) {
+	_, host := verifierServer(t, nil)
+	tests := []struct {
+		name   string
+		offset time.Duration
+		status int
+	}{
+		{name: "slow clock", offset: -10 * time.Minute, status: http.StatusOK},
+		{name: "fast clock", offset: 10 * time.Minute, status: http.StatusOK},
+		{name: "too old", offset: -20 * time.Minute, status: http.StatusForbidden},
+		{name: "too far ahead", offset: 20 * time.Minute, status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status, body := send(t, signAt(t, time.Now().Add(test.offset), host, "us-east-1", "SECRET", test.name)); status != test.status {
+				t.Errorf("got %d %q, want %d", status, body, test.status)
+			}
+		})
+	}
+
+	// MaxSkew narrows the window
+	_, host = verifierServer(t, &Verifier{Service: "execute-api", Region: "us-east-1", Secrets: staticSecrets{"AKID": "SECRET"}, MaxSkew: time.Minute})
+	if status, _ := send(t, signAt(t, time.Now().Add(-2*time.Minute), host, "us-east-1", "SECRET", "x")); status != http.StatusForbidden {
+		t.Errorf("got %d outside a one minute window", status)
+	}
+}
+
+func TestVerifierPresigned(t *testing.T) {
+	server, _ := verifierServer(t, nil)
+	s := Signer{Service: "execute-api", Region: "us-east-1", Credentials: testCredentials}
+	get := func(rawURL string) int {
+		t.Helper()
+		resp, err := http.Get(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	presigned, err := s.Presign("GET", server.URL+"/items?q=1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Presigned URLs may be used until they expire
+	for i := 0; i < 2; i++ {
+		if status := get(presigned); status != http.StatusOK {
+			t.Fatalf("got %d for a presigned URL", status)
+		}
+	}
+
+	tampered := strings.Replace(presigned, "q=1", "q=2", 1)
+	if status := get(tampered); status != http.StatusForbidden {
+		t.Errorf("got %d for a tampered presigned URL", status)
+	}
+	expired, err := s.presignAt(time.Now().Add(-2*time.Minute), "GET", server.URL+"/items", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := get(expired); status != http.StatusForbidden {
+		t.Errorf("got %d for an expired presigned URL", status)
+	}
+	u, _ := url.Parse(presigned)
+	query := u.Query()
+	query.Set("X-Amz-Expires", "604801")
+	u.RawQuery = query.Encode()
+	if status := get(u.String()); status != http.StatusForbidden {
+		t.Errorf("got %d for a presigned URL valid for too long", status)
+	}
+}
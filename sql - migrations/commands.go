@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shff/opb/migrate"
+)
+
+// printStatus lists every migration as applied, pending, modified when its
+// file changed after it was applied, or missing when it was applied but its
+// file no longer exists.
+func printStatus(ctx context.Context, m *migrate.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "-"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.ID, s.Name, s.State, appliedAt)
+	}
+	return w.Flush()
+}
+
+func verify(ctx context.Context, m *migrate.Migrator) error {
+	problems, err := m.Verify(ctx)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	log.Printf("Migrations verified")
+	return nil
+}
+
+// writeDiff creates a migration turning the database into the schema in
+// schemaFile, or prints it on a dry run.
+func writeDiff(ctx context.Context, m *migrate.Migrator, schemaFile, name string, dryRun bool) error {
+	desiredSQL, err := os.ReadFile(schemaFile)
+	if err != nil {
+		return fmt.Errorf("failed to read desired schema: %w", err)
+	}
+	up, down, err := m.Diff(ctx, string(desiredSQL))
+	if err != nil {
+		return err
+	}
+	if len(up) == 0 {
+		log.Printf("The database matches %s", schemaFile)
+		return nil
+	}
+
+	if dryRun {
+		fmt.Printf("-- up\n%s\n-- down\n%s", joinStatements(up), joinStatements(down))
+		return nil
+	}
+	timestamp := time.Now().Format("20060102150405")
+	upFile := fmt.Sprintf("migrations/%s_%s_up.sql", timestamp, name)
+	downFile := fmt.Sprintf("migrations/%s_%s_down.sql", timestamp, name)
+	if err := os.WriteFile(upFile, []byte(joinStatements(up)), 0644); err != nil {
+		return fmt.Errorf("failed to create up migration file: %w", err)
+	}
+	if err := os.WriteFile(downFile, []byte(joinStatements(down)), 0644); err != nil {
+		return fmt.Errorf("failed to create down migration file: %w", err)
+	}
+
+	log.Printf("Created migration files:\n  %s\n  %s", upFile, downFile)
+	return nil
+}
+
+// writeDump writes the database schema to file.
+func writeDump(ctx context.Context, m *migrate.Migrator, file string) error {
+	statements, err := m.Dump(ctx)
+	if err != nil {
+		return err
+	}
+	header := fmt.Sprintf("-- Schema snapshot written by the migrations runner on %s\n\n", time.Now().Format("2006-01-02 15:04:05"))
+	if err := os.WriteFile(file, []byte(header+joinStatements(statements)), 0644); err != nil {
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+	log.Printf("Wrote %d statements to %s", len(statements), file)
+	return nil
+}
+
+// joinStatements ends each statement with a semicolon, leaving comments as
+// they are.
+func joinStatements(statements []string) string {
+	var b strings.Builder
+	for _, statement := range statements {
+		b.WriteString(statement)
+		if !strings.HasPrefix(statement, "--") {
+			b.WriteString(";")
+		}
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+// writeSquash replaces the files of the migrations from one ID to another
+// with a baseline, or prints the baseline on a dry run.
+func writeSquash(ctx context.Context, m *migrate.Migrator, from, to int, name string, dryRun bool) error {
+	squashed, err := m.Squash(ctx, from, to, name)
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, 0, len(squashed.Files))
+	for file := range squashed.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	if dryRun {
+		for _, file := range files {
+			fmt.Printf("-- %s\n%s\n", file, squashed.Files[file])
+		}
+		return nil
+	}
+
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join("migrations", file), []byte(squashed.Files[file]), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+	}
+	for _, file := range squashed.Replaced {
+		if _, written := squashed.Files[file]; written {
+			continue
+		}
+		if err := os.Remove(filepath.Join("migrations", file)); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", file, err)
+		}
+	}
+
+	log.Printf("Squashed %d files into migration %d (%s):\n  %s", len(squashed.Replaced), squashed.ID, name, strings.Join(files, "\n  "))
+	return nil
+}
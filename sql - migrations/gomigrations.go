@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/shff/opb/migrate"
+)
+
+// Migrations written in Go, in registration order
+var goMigrations []migrate.Migration
+
+// registerMigration adds a Go migration, usually from an init function in
+// this package. The ID orders it among the SQL migrations, so it should use
+// the timestamp format of the files made by -create:
+//
+//	func init() {
+//		registerMigration(20250301120000, "backfill_person_information", backfillUp, nil)
+//	}
+//
+// A nil down function makes rolling the migration back a no-op.
+func registerMigration(id int, name string, up, down migrate.MigrationFunc) {
+	for _, m := range goMigrations {
+		if m.ID == id {
+			panic(fmt.Sprintf("migration %d registered twice", id))
+		}
+	}
+	goMigrations = append(goMigrations, migrate.Migration{ID: id, Name: name, Up: up, Down: down})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"testing"
+
+	"github.com/shff/opb/migrate"
+)
+
+func TestGoMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	fsys, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.New(db, fsys, migrate.Options{Driver: "sqlite3", GoMigrations: goMigrations})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.UpTo(ctx, 20241220001457); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO users (id, email, password) VALUES (1, ' Alice@Example.COM ', ''), (2, 'ÉLODIE@example.com', '')"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[int]string{1: "alice@example.com", 2: "élodie@example.com"} {
+		var got string
+		if err := db.QueryRow("SELECT email_normalized FROM users WHERE id = ?", id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("user %d: got %q, want %q", id, got, want)
+		}
+	}
+
+	if err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var columns int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('users') WHERE name = 'email_normalized'").Scan(&columns); err != nil {
+		t.Fatal(err)
+	}
+	if columns != 0 {
+		t.Error("rolling back left email_normalized behind")
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.ID != 20250301120000 || last.State != migrate.Pending {
+		t.Errorf("got %+v, want normalize_emails pending", last)
+	}
+}
+
+func TestRegisterMigrationRejectsDuplicates(t *testing.T) {
+	defer func(registered []migrate.Migration) { goMigrations = registered }(goMigrations)
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an ID twice did not panic")
+		}
+	}()
+	registerMigration(20250301120000, "again", normalizeEmailsUp, nil)
+}
@@ -1,36 +1,61 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/shff/opb/migrate"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations
 var migrationFiles embed.FS
 
-type Migration struct {
-	ID      int
-	Name    string
-	UpSQL   string
-	DownSQL string
-}
+//go:embed seeds
+var seedFiles embed.FS
+
+// The local development database, used when neither -dsn nor DATABASE_URL
+// is set.
+const defaultDSN = "file:mydb.db?cache=shared&mode=rwc"
 
 func main() {
 	// Parse command-line arguments
 	rollback := flag.Int("rollback", 0, "Rollback the last N migrations")
 	create := flag.String("create", "", "Create a new migration with the given name")
+	driverFlag := flag.String("driver", "", "Database driver: sqlite3 or postgres (default: inferred from the DSN)")
+	dsnFlag := flag.String("dsn", "", "Database connection string (default: $DATABASE_URL or the local SQLite database)")
+	scratchDSN := flag.String("scratch-dsn", "", "Postgres database that verify and diff create throwaway schemas in; required for them on Postgres")
+	allowDrift := flag.Bool("allow-drift", false, "Warn instead of failing when applied migrations were modified or removed")
+	outOfOrder := flag.String("out-of-order", "error", "What to do with pending migrations older than the last applied one: error, allow or warn")
+	lockTimeout := flag.Duration("lock-timeout", time.Minute, "How long to wait for another process to release the migration lock")
+	forceUnlock := flag.Bool("force-unlock", false, "Release the migration lock held by a process that hangs, then exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+		fmt.Fprintln(flag.CommandLine.Output(), "  status                     Show applied, pending and missing migrations")
+		fmt.Fprintln(flag.CommandLine.Output(), "  up [-to ID] [-dry-run]     Apply pending migrations, up to and including ID (default)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  down [-to ID] [-dry-run]   Roll back the last migration, or every migration after ID")
+		fmt.Fprintln(flag.CommandLine.Output(), "  redo [-dry-run]            Roll back the last migration and apply it again")
+		fmt.Fprintln(flag.CommandLine.Output(), "  verify                     Apply, roll back and reapply every migration on a scratch database")
+		fmt.Fprintln(flag.CommandLine.Output(), "                             (on Postgres, a schema of -scratch-dsn)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  diff [-schema FILE] [-name NAME] [-dry-run]")
+		fmt.Fprintln(flag.CommandLine.Output(), "                             Create a migration turning the database into the schema in FILE")
+		fmt.Fprintln(flag.CommandLine.Output(), "  dump [-schema FILE]        Write the database schema to FILE")
+		fmt.Fprintln(flag.CommandLine.Output(), "  seed -env ENV [-dry-run]   Run the seeds of ENV (dev, test or prod) that changed since they last ran")
+		fmt.Fprintln(flag.CommandLine.Output(), "  squash [-from ID] -to ID [-name NAME] [-dry-run]")
+		fmt.Fprintln(flag.CommandLine.Output(), "                             Replace the applied migrations from ID to ID with one baseline")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if *create != "" {
@@ -40,43 +65,104 @@ func main() {
 		return
 	}
 
+	// Parse the command, applying every pending migration by default
+	command, args := "up", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	commandFlags := flag.NewFlagSet(command, flag.ExitOnError)
+	to := commandFlags.Int("to", 0, "ID of the migration to migrate up or down to, or the last one to squash")
+	from := commandFlags.Int("from", 0, "ID of the first migration to squash (default: the first one)")
+	dryRun := commandFlags.Bool("dry-run", false, "Print the SQL that would run without executing it")
+	schemaFile := commandFlags.String("schema", "schema.sql", "Desired schema file for diff, or the file dump writes")
+	env := commandFlags.String("env", "", "Environment whose seeds to run: dev, test or prod")
+	defaultName := "schema_diff"
+	if command == "squash" {
+		defaultName = "baseline"
+	}
+	name := commandFlags.String("name", defaultName, "Name of the migration diff or squash creates")
+	commandFlags.Parse(args)
+
 	// Connect to the database
-	db, err := sql.Open("sqlite3", "file:mydb.db?cache=shared&mode=rwc")
+	driver, dsn, err := dataSource(*driverFlag, *dsnFlag)
+	if err != nil {
+		log.Fatalf("Failed to configure database: %v", err)
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
-	// Ensure the migration tracking table exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			id INT PRIMARY KEY,
-			name TEXT NOT NULL,
-			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-	`)
-	if err != nil {
-		log.Fatalf("Failed to create schema_migrations table: %v", err)
+	var scratchDB *sql.DB
+	if *scratchDSN != "" {
+		scratchDB, err = sql.Open(driver, *scratchDSN)
+		if err != nil {
+			log.Fatalf("Failed to connect to scratch database: %v", err)
+		}
+		defer scratchDB.Close()
 	}
 
-	// Load all migrations
-	migrations, err := loadMigrations()
+	fsys, err := fs.Sub(migrationFiles, "migrations")
 	if err != nil {
 		log.Fatalf("Failed to load migrations: %v", err)
 	}
-
-	if *rollback > 0 {
-		if err := rollbackMigration(db, migrations, *rollback); err != nil {
-			log.Fatalf("Failed to rollback migration: %v", err)
-		}
-		return
+	seeds, err := fs.Sub(seedFiles, "seeds")
+	if err != nil {
+		log.Fatalf("Failed to load seeds: %v", err)
+	}
+	m, err := migrate.New(db, fsys, migrate.Options{
+		Driver:       driver,
+		Seeds:        seeds,
+		GoMigrations: goMigrations,
+		AllowDrift:   *allowDrift,
+		OutOfOrder:   migrate.OutOfOrderPolicy(*outOfOrder),
+		LockTimeout:  *lockTimeout,
+		DryRun:       *dryRun,
+		ScratchDB:    scratchDB,
+		Logf:         log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch {
+	case *forceUnlock:
+		command = "force-unlock"
+		err = m.ForceUnlock(ctx)
+	case *rollback > 0:
+		err = m.Rollback(ctx, *rollback)
+	case command == "status":
+		err = printStatus(ctx, m)
+	case command == "up":
+		err = m.UpTo(ctx, *to)
+	case command == "down" && *to == 0:
+		err = m.Down(ctx)
+	case command == "down":
+		err = m.DownTo(ctx, *to)
+	case command == "redo":
+		err = m.Redo(ctx)
+	case command == "verify":
+		err = verify(ctx, m)
+	case command == "diff":
+		err = writeDiff(ctx, m, *schemaFile, *name, *dryRun)
+	case command == "dump":
+		err = writeDump(ctx, m, *schemaFile)
+	case command == "seed" && *env == "":
+		log.Fatalf("seed needs -env, the environment whose seeds to run")
+	case command == "seed":
+		err = m.Seed(ctx, *env)
+	case command == "squash" && *to == 0:
+		log.Fatalf("squash needs -to, the ID of the last migration to squash")
+	case command == "squash":
+		err = writeSquash(ctx, m, *from, *to, *name, *dryRun)
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
-
-	// Apply each migration
-	for _, migration := range migrations {
-		if err := applyMigration(db, migration); err != nil {
-			log.Fatalf("Failed to apply migration %d: %v", migration.ID, err)
-		}
+	if err != nil {
+		log.Fatalf("Failed to run %s: %v", command, err)
 	}
 }
 
@@ -98,136 +184,31 @@ func createMigrationFile(name string) error {
 	return nil
 }
 
-func loadMigrations() ([]Migration, error) {
-	// Read all embedded SQL files
-	files, err := migrationFiles.ReadDir("migrations")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
-	}
-
-	// Parse migration files
-	migrationsMap := map[int]*Migration{}
-	for _, file := range files {
-		name := file.Name()
-		parts := strings.SplitN(name, "_", -1)
-		if len(parts) < 3 {
-			continue
-		}
-
-		// Extract ID and type (up/down)
-		id := parts[0]
-		title := strings.Join(parts[1:len(parts)-1], "_")
-		migrationType := parts[len(parts)-1]
-
-		migrationID, err := strconv.Atoi(id)
-		if err != nil {
-			return nil, fmt.Errorf("invalid migration ID in file %s: %w", name, err)
-		}
-
-		// Read the SQL content
-		content, err := migrationFiles.ReadFile(filepath.Join("migrations", name))
-		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s: %w", name, err)
-		}
-
-		// Add or update the migration
-		if _, exists := migrationsMap[migrationID]; !exists {
-			migrationsMap[migrationID] = &Migration{
-				ID:   migrationID,
-				Name: title,
-			}
-		}
-
-		if migrationType == "up.sql" {
-			migrationsMap[migrationID].UpSQL = string(content)
-		} else if migrationType == "down.sql" {
-			migrationsMap[migrationID].DownSQL = string(content)
-		}
-	}
-
-	// Convert map to slice and sort by ID
-	migrations := make([]Migration, 0, len(migrationsMap))
-	for _, migration := range migrationsMap {
-		migrations = append(migrations, *migration)
-	}
-	sort.Slice(migrations, func(i, j int) bool {
-		return migrations[i].ID < migrations[j].ID
-	})
-
-	return migrations, nil
-}
-
-func applyMigration(db *sql.DB, migration Migration) error {
-	// Check if the migration has already been applied
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE id = ?)", migration.ID).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check migration: %w", err)
-	}
-	if exists {
-		log.Printf("Migration %d (%s) already applied", migration.ID, migration.Name)
-		return nil
-	}
-
-	// Apply the migration
-	log.Printf("Applying migration %d (%s)...", migration.ID, migration.Name)
-	if _, err := db.Exec(migration.UpSQL); err != nil {
-		return fmt.Errorf("failed to apply migration: %w", err)
-	}
-
-	// Record the migration as applied
-	_, err = db.Exec("INSERT INTO schema_migrations (id, name, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)", migration.ID, migration.Name)
-	if err != nil {
-		return fmt.Errorf("failed to record migration: %w", err)
-	}
-
-	log.Printf("Migration %d (%s) applied successfully", migration.ID, migration.Name)
-	return nil
-}
-
-func rollbackMigration(db *sql.DB, migrations []Migration, count int) error {
-	rows, err := db.Query("SELECT id FROM schema_migrations ORDER BY id DESC LIMIT ?", count)
-	if err != nil {
-		return fmt.Errorf("failed to fetch last migrations: %w", err)
+// dataSource resolves the driver and connection string from the flags,
+// falling back to DATABASE_URL and then to the local SQLite database. When no
+// driver is given it is inferred from the connection string's scheme.
+func dataSource(driver, dsn string) (string, string, error) {
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
 	}
-	defer rows.Close()
 
-	var migrationIDs []int
-	for rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err != nil {
-			return fmt.Errorf("failed to scan migration ID: %w", err)
+	if driver == "" {
+		switch {
+		case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+			driver = "postgres"
+		default:
+			driver = "sqlite3"
 		}
-		migrationIDs = append(migrationIDs, id)
 	}
-
-	if len(migrationIDs) == 0 {
-		return fmt.Errorf("no migrations to rollback")
+	if !migrate.Supported(driver) {
+		return "", "", fmt.Errorf("unsupported driver %q", driver)
 	}
 
-	for _, id := range migrationIDs {
-		var migration *Migration
-		for _, m := range migrations {
-			if m.ID == id {
-				migration = &m
-				break
-			}
+	if driver == "sqlite3" {
+		if dsn == "" {
+			dsn = defaultDSN
 		}
-		if migration == nil {
-			return fmt.Errorf("migration %d not found", id)
-		}
-
-		log.Printf("Rolling back migration %d (%s)...", migration.ID, migration.Name)
-		if _, err := db.Exec(migration.DownSQL); err != nil {
-			return fmt.Errorf("failed to rollback migration %d: %w", migration.ID, err)
-		}
-
-		_, err := db.Exec("DELETE FROM schema_migrations WHERE id = ?", migration.ID)
-		if err != nil {
-			return fmt.Errorf("failed to delete migration record %d: %w", migration.ID, err)
-		}
-
-		log.Printf("Migration %d (%s) rolled back successfully", migration.ID, migration.Name)
+		dsn = strings.TrimPrefix(dsn, "sqlite://")
 	}
-	return nil
+	return driver, dsn, nil
 }
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestDataSource(t *testing.T) {
+	tests := []struct {
+		driver, dsn, env string
+		wantDriver       string
+		wantDSN          string
+	}{
+		{"", "", "", "sqlite3", defaultDSN},
+		{"", "", "postgres://db/app", "postgres", "postgres://db/app"},
+		{"", "postgresql://db/app", "postgres://other/app", "postgres", "postgresql://db/app"},
+		{"", "sqlite://data.db", "", "sqlite3", "data.db"},
+		{"postgres", "host=db dbname=app", "", "postgres", "host=db dbname=app"},
+	}
+	for _, test := range tests {
+		t.Setenv("DATABASE_URL", test.env)
+		driver, dsn, err := dataSource(test.driver, test.dsn)
+		if err != nil {
+			t.Errorf("%q %q: %v", test.driver, test.dsn, err)
+			continue
+		}
+		if driver != test.wantDriver || dsn != test.wantDSN {
+			t.Errorf("%q %q: got %s %q, want %s %q", test.driver, test.dsn, driver, dsn, test.wantDriver, test.wantDSN)
+		}
+	}
+
+	if _, _, err := dataSource("mysql", ""); err == nil {
+		t.Error("got no error for an unsupported driver")
+	}
+}
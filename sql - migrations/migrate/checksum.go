@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+func checksum(migrationSQL string) string {
+	sum := sha256.Sum256([]byte(migrationSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+// ensureChecksumColumns adds the checksum columns to a schema_migrations
+// table created before checksums were recorded.
+func (m *Migrator) ensureChecksumColumns(ctx context.Context) error {
+	for _, column := range []string{"up_checksum", "down_checksum"} {
+		if m.hasColumn(ctx, column) {
+			continue
+		}
+		if _, err := m.conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE schema_migrations ADD COLUMN %s TEXT", column)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether schema_migrations exists and has the column.
+func (m *Migrator) hasColumn(ctx context.Context, column string) bool {
+	rows, err := m.conn.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM schema_migrations WHERE 1 = 0", column))
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// verifyChecksums compares every applied migration with its file and
+// describes the ones whose SQL changed or whose file disappeared. Migrations
+// applied before checksums were recorded adopt the checksums of their
+// current files, except on a dry run.
+func (m *Migrator) verifyChecksums(ctx context.Context, migrations []Migration) ([]string, error) {
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, a := range applied {
+		migration := findMigration(migrations, a.ID)
+		if migration == nil && squashedBy(migrations, a.ID) != nil {
+			// Left to be replaced by the baseline's record, on a dry run
+			continue
+		}
+		if migration == nil {
+			problems = append(problems, fmt.Sprintf("migration %d (%s) was applied but its file is missing", a.ID, a.Name))
+			continue
+		}
+
+		if !a.UpChecksum.Valid && !a.DownChecksum.Valid {
+			if m.opts.DryRun {
+				continue
+			}
+			_, err := m.conn.ExecContext(ctx, m.dialect.rebind("UPDATE schema_migrations SET up_checksum = ?, down_checksum = ? WHERE id = ?"),
+				checksum(migration.UpSQL), checksum(migration.DownSQL), a.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record checksums of migration %d: %w", a.ID, err)
+			}
+			m.logf("Recorded checksums of migration %d (%s)", a.ID, a.Name)
+			continue
+		}
+
+		if squashesApplied(*migration, applied) {
+			// The record is that of the last migration the baseline
+			// replaces until a run that isn't dry swaps it
+			continue
+		}
+		for _, direction := range drift(*migration, a) {
+			problems = append(problems, fmt.Sprintf("migration %d (%s) was applied but its %s SQL has changed", a.ID, a.Name, direction))
+		}
+	}
+	return problems, nil
+}
+
+// drift returns the directions whose SQL no longer matches the checksum
+// recorded when the migration was applied.
+func drift(migration Migration, a appliedMigration) []string {
+	var directions []string
+	if a.UpChecksum.Valid && a.UpChecksum.String != checksum(migration.UpSQL) {
+		directions = append(directions, "up")
+	}
+	if a.DownChecksum.Valid && a.DownChecksum.String != checksum(migration.DownSQL) {
+		directions = append(directions, "down")
+	}
+	return directions
+}
@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDrift(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	if err := testMigrator(t, db, testFiles(), Options{}).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files := testFiles()
+	files["1_users_down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE IF EXISTS users;")}
+	delete(files, "2_posts_up.sql")
+	delete(files, "2_posts_down.sql")
+	files["3_tags_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (id INTEGER PRIMARY KEY);")}
+
+	var warnings []string
+	logf := func(format string, args ...interface{}) {
+		if strings.HasPrefix(format, "Warning") {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+	}
+
+	err := testMigrator(t, db, files, Options{Logf: logf}).Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "differ from their files") {
+		t.Fatalf("got %v, want a drift error", err)
+	}
+	want := []string{
+		"Warning: migration 1 (users) was applied but its down SQL has changed",
+		"Warning: migration 2 (posts) was applied but its file is missing",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("got warnings %q, want %q", warnings, want)
+	}
+
+	m := testMigrator(t, db, files, Options{AllowDrift: true})
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for _, s := range statuses {
+		states = append(states, fmt.Sprintf("%d %s", s.ID, s.State))
+	}
+	if want := []string{"1 modified", "3 pending", "2 missing"}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("got applied %v, want [1 2 3]", got)
+	}
+}
+
+func TestChecksumsAdoptedForOldRecords(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);
+		CREATE TABLE schema_migrations (id BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_migrations (id, name) VALUES (1, 'users');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := testMigrator(t, db, testFiles(), Options{})
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once adopted, a change to the file is drift
+	files := testFiles()
+	files["1_users_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")}
+	statuses, err := testMigrator(t, db, files, Options{}).Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].State != Modified {
+		t.Errorf("got %s, want modified", statuses[0].State)
+	}
+}
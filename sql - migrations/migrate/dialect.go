@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect describes how migrations run against one database driver.
+// Files in the Dir subdirectory replace the shared file of the same name, so
+// a migration only needs a dialect specific copy when the SQL differs.
+type dialect struct {
+	Dir string
+	// TransactionalDDL is set when DDL statements can be rolled back as
+	// part of a transaction
+	TransactionalDDL bool
+	// Placeholder returns the bind parameter for the nth (1-based) argument
+	Placeholder func(n int) string
+	// Lock waits up to timeout for the migration lock and returns the
+	// connection migrations run on while it is held, and the function that
+	// releases it
+	Lock func(ctx context.Context, db *sql.DB, timeout time.Duration, logf func(string, ...interface{})) (conn, func() error, error)
+	// Heartbeat, when set, keeps the lock alive from inside the transaction
+	// of each migration
+	Heartbeat func(ctx context.Context, tx execer) error
+	// Unlock releases the migration lock whoever holds it
+	Unlock func(ctx context.Context, db *sql.DB) error
+}
+
+var dialects = map[string]dialect{
+	"sqlite3": {
+		Dir:              "sqlite",
+		TransactionalDDL: true,
+		Placeholder:      func(int) string { return "?" },
+		Lock:             lockSQLite,
+		Heartbeat:        heartbeatSQLite,
+		Unlock:           unlockSQLite,
+	},
+	"postgres": {
+		Dir:              "postgres",
+		TransactionalDDL: true,
+		Placeholder:      func(n int) string { return "$" + strconv.Itoa(n) },
+		Lock:             lockPostgres,
+		Unlock:           unlockPostgres,
+	},
+}
+
+// Supported reports whether driver is one of the drivers New accepts.
+func Supported(driver string) bool {
+	_, ok := dialects[driver]
+	return ok
+}
+
+// rebind rewrites the ? placeholders of a bookkeeping query for the driver.
+func (d dialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,14 @@
+package migrate
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE schema_migrations SET up_checksum = ?, down_checksum = ? WHERE id = ?"
+	if got := dialects["sqlite3"].rebind(query); got != query {
+		t.Errorf("got %q for sqlite3", got)
+	}
+	want := "UPDATE schema_migrations SET up_checksum = $1, down_checksum = $2 WHERE id = $3"
+	if got := dialects["postgres"].rebind(query); got != want {
+		t.Errorf("got %q for postgres, want %q", got, want)
+	}
+}
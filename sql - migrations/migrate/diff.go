@@ -0,0 +1,213 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// diffSchemas returns the statements turning the from schema into the to
+// schema: dropped indexes and constraints first, including the foreign keys
+// of dropped tables, then tables and columns, then new constraints and
+// indexes. SQLite can't alter columns or constraints in place; those changes
+// come out as comments saying the table has to be rebuilt.
+func diffSchemas(driver string, from, to *dbSchema) []string {
+	postgres := driver == "postgres"
+	var statements []string
+
+	for _, index := range from.Indexes {
+		if want := to.index(index.Name); want == nil || want.Create != index.Create {
+			statements = append(statements, "DROP INDEX "+index.Name)
+		}
+	}
+
+	for _, t := range from.Tables {
+		want := to.table(t.Name)
+		for _, name := range sortedConstraints(t) {
+			if want == nil {
+				// SQLite drops them along with the table
+				if postgres && t.Constraints[name].ForeignKey {
+					statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", t.Name, name))
+				}
+				continue
+			}
+			if c, ok := want.Constraints[name]; ok && c == t.Constraints[name] {
+				continue
+			}
+			if postgres {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", t.Name, name))
+			} else {
+				statements = append(statements, fmt.Sprintf("-- %s: drop %s (SQLite requires rebuilding the table)", t.Name, name))
+			}
+		}
+	}
+
+	for _, t := range to.Tables {
+		if from.table(t.Name) == nil {
+			statements = append(statements, createTable(driver, t))
+		}
+	}
+
+	for _, t := range to.Tables {
+		have := from.table(t.Name)
+		if have == nil {
+			continue
+		}
+		for _, c := range t.Columns {
+			current := have.column(c.Name)
+			switch {
+			case current == nil:
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", t.Name, c.definition()))
+			case *current == c:
+			case !postgres:
+				statements = append(statements, fmt.Sprintf("-- %s: change column %s to %s (SQLite requires rebuilding the table)", t.Name, current.definition(), c.definition()))
+			default:
+				statements = append(statements, alterColumn(t.Name, *current, c)...)
+			}
+		}
+		for _, c := range have.Columns {
+			if t.column(c.Name) == nil {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t.Name, c.Name))
+			}
+		}
+	}
+
+	for _, t := range dropOrder(from, to) {
+		statements = append(statements, "DROP TABLE "+t.Name)
+	}
+
+	for _, t := range to.Tables {
+		have := from.table(t.Name)
+		if have == nil {
+			statements = append(statements, foreignKeys(driver, t)...)
+			continue
+		}
+		for _, name := range sortedConstraints(t) {
+			if c, ok := have.Constraints[name]; ok && c == t.Constraints[name] {
+				continue
+			}
+			if postgres {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", t.Name, name, t.Constraints[name].Definition))
+			} else {
+				statements = append(statements, fmt.Sprintf("-- %s: add %s (SQLite requires rebuilding the table)", t.Name, name))
+			}
+		}
+	}
+
+	for _, index := range to.Indexes {
+		if have := from.index(index.Name); have == nil || have.Create != index.Create {
+			statements = append(statements, index.Create)
+		}
+	}
+	return statements
+}
+
+// dropOrder returns the tables of from that to lacks, each one after the
+// dropped tables referencing it, as SQLite enforcing foreign keys refuses to
+// drop a table whose rows are still referenced.
+func dropOrder(from, to *dbSchema) []*schemaTable {
+	var dropped []*schemaTable
+	for i := len(from.Tables) - 1; i >= 0; i-- {
+		if t := from.Tables[i]; to.table(t.Name) == nil {
+			dropped = append(dropped, t)
+		}
+	}
+
+	var order []*schemaTable
+	visited := map[string]bool{}
+	var visit func(t *schemaTable)
+	visit = func(t *schemaTable) {
+		if visited[t.Name] {
+			return
+		}
+		visited[t.Name] = true
+		for _, referencing := range dropped {
+			for _, c := range referencing.Constraints {
+				if c.ForeignKey && c.References == t.Name {
+					visit(referencing)
+				}
+			}
+		}
+		order = append(order, t)
+	}
+	for _, t := range dropped {
+		visit(t)
+	}
+	return order
+}
+
+func alterColumn(table string, from, to schemaColumn) []string {
+	prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", table, to.Name)
+	var statements []string
+	if from.Type != to.Type {
+		statements = append(statements, prefix+"TYPE "+to.Type)
+	}
+	if from.NotNull != to.NotNull {
+		if to.NotNull {
+			statements = append(statements, prefix+"SET NOT NULL")
+		} else {
+			statements = append(statements, prefix+"DROP NOT NULL")
+		}
+	}
+	if from.Default != to.Default {
+		if to.Default.Valid {
+			statements = append(statements, prefix+"SET DEFAULT "+to.Default.String)
+		} else {
+			statements = append(statements, prefix+"DROP DEFAULT")
+		}
+	}
+	return statements
+}
+
+// Diff compares the database with the desired schema, given as the SQL
+// creating it, and returns the statements of a migration making the change
+// and of the one undoing it. Both are empty when nothing differs. Pending
+// migrations are reported since the diff would repeat them. The database is
+// only read.
+func (m *Migrator) Diff(ctx context.Context, desiredSQL string) (up, down []string, err error) {
+	r := m.readOnly()
+	migrations, err := r.prepare(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := r.loadApplied(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(applied) < len(migrations) {
+		m.logf("Warning: %d migrations are pending; the diff is against the current database", len(migrations)-len(applied))
+	}
+
+	scratch, cleanup, err := m.scratchMigrator(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open scratch database: %w", err)
+	}
+	defer cleanup()
+	if err := execMigration(ctx, scratch.conn, m.opts.Driver, "desired schema", desiredSQL, nil); err != nil {
+		return nil, nil, fmt.Errorf("failed to load desired schema: %w", err)
+	}
+
+	live, err := readSchema(ctx, m.conn, m.opts.Driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	desired, err := readSchema(ctx, scratch.conn, m.opts.Driver)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	up = diffSchemas(m.opts.Driver, live, desired)
+	if len(up) == 0 {
+		return nil, nil, nil
+	}
+	return up, diffSchemas(m.opts.Driver, desired, live), nil
+}
+
+// Dump returns the statements recreating the tables and indexes of the
+// database, in a form Diff accepts as the desired schema.
+func (m *Migrator) Dump(ctx context.Context) ([]string, error) {
+	s, err := readSchema(ctx, m.conn, m.opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return schemaStatements(m.opts.Driver, s), nil
+}
@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDiffDropsReferencedTablesLast(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	// posts is created first, so reverse creation order would drop users
+	// while a post still references it
+	_, err := db.Exec(`
+		PRAGMA foreign_keys = ON;
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id));
+		CREATE TABLE users (id INTEGER PRIMARY KEY);
+		INSERT INTO users VALUES (1);
+		INSERT INTO posts VALUES (1, 1);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := testMigrator(t, db, testFiles(), Options{})
+
+	up, down, err := m.Diff(ctx, "CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUp := []string{
+		"CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT)",
+		"DROP TABLE posts",
+		"DROP TABLE users",
+	}
+	if !reflect.DeepEqual(up, wantUp) {
+		t.Errorf("got up %q, want %q", up, wantUp)
+	}
+	wantDown := []string{
+		"CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id))",
+		"CREATE TABLE users (id INTEGER PRIMARY KEY)",
+		"DROP TABLE tags",
+	}
+	if !reflect.DeepEqual(down, wantDown) {
+		t.Errorf("got down %q, want %q", down, wantDown)
+	}
+
+	for _, statements := range [][]string{up, down} {
+		for _, statement := range statements {
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatalf("%s: %v", statement, err)
+			}
+		}
+	}
+}
+
+func TestDiffPostgresDropsForeignKeysFirst(t *testing.T) {
+	zones := &schemaTable{
+		Name:    "zones",
+		Columns: []schemaColumn{{Name: "id", Type: "serial", NotNull: true}},
+		Constraints: map[string]schemaConstraint{
+			"zones_pkey": {Definition: "PRIMARY KEY (id)"},
+		},
+	}
+	accounts := &schemaTable{
+		Name:    "accounts",
+		Columns: []schemaColumn{{Name: "id", Type: "serial", NotNull: true}, {Name: "zone_id", Type: "integer"}},
+		Constraints: map[string]schemaConstraint{
+			"accounts_pkey":         {Definition: "PRIMARY KEY (id)"},
+			"accounts_zone_id_fkey": {Definition: "FOREIGN KEY (zone_id) REFERENCES zones(id)", ForeignKey: true, References: "zones"},
+		},
+	}
+	live := &dbSchema{Tables: []*schemaTable{accounts, zones}}
+	empty := &dbSchema{}
+
+	up := diffSchemas("postgres", live, empty)
+	wantUp := []string{
+		"ALTER TABLE accounts DROP CONSTRAINT accounts_zone_id_fkey",
+		"DROP TABLE accounts",
+		"DROP TABLE zones",
+	}
+	if !reflect.DeepEqual(up, wantUp) {
+		t.Errorf("got up %q, want %q", up, wantUp)
+	}
+
+	down := diffSchemas("postgres", empty, live)
+	wantDown := []string{
+		"CREATE TABLE accounts (\n  id serial NOT NULL,\n  zone_id integer,\n  CONSTRAINT accounts_pkey PRIMARY KEY (id)\n)",
+		"CREATE TABLE zones (\n  id serial NOT NULL,\n  CONSTRAINT zones_pkey PRIMARY KEY (id)\n)",
+		"ALTER TABLE accounts ADD CONSTRAINT accounts_zone_id_fkey FOREIGN KEY (zone_id) REFERENCES zones(id)",
+	}
+	if !reflect.DeepEqual(down, wantDown) {
+		t.Errorf("got down %q, want %q", down, wantDown)
+	}
+}
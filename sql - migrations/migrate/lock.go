@@ -0,0 +1,222 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Key of the Postgres advisory lock held while migrating. It fits in 32 bits
+// so that pg_locks reports it in objid alone.
+const advisoryLockKey = 1935767146
+
+const lockRetryInterval = time.Second
+
+// A SQLite lock row whose heartbeat is older than lockExpiry belongs to a
+// process that died, and is taken over. The holder refreshes it every
+// lockHeartbeat.
+const (
+	lockExpiry    = time.Minute
+	lockHeartbeat = 10 * time.Second
+)
+
+// lockHolder identifies this process in lock rows and error messages.
+func lockHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown host"
+	}
+	return fmt.Sprintf("%s (pid %d)", host, os.Getpid())
+}
+
+// wait sleeps until the next lock attempt unless ctx is done first.
+func wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(lockRetryInterval):
+		return nil
+	}
+}
+
+// lockPostgres takes a session level advisory lock, which lives on one
+// connection and is released by Postgres if the process dies. Migrations run
+// on that connection too, so that they don't wait for a second one from a
+// pool limited to one.
+func lockPostgres(ctx context.Context, db *sql.DB, timeout time.Duration, logf func(string, ...interface{})) (conn, func() error, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryLockKey).Scan(&locked); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			holder := postgresLockHolder(ctx, conn)
+			conn.Close()
+			return nil, nil, fmt.Errorf("timed out after %s waiting for the lock held by %s", timeout, holder)
+		}
+		if err := wait(ctx); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	return conn, func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+		return err
+	}, nil
+}
+
+func postgresLockHolder(ctx context.Context, conn *sql.Conn) string {
+	var pid int
+	var application, client string
+	var since time.Time
+	err := conn.QueryRowContext(ctx, `
+		SELECT a.pid, COALESCE(a.application_name, ''), COALESCE(host(a.client_addr), 'local'), a.backend_start
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.classid = 0 AND l.objid = $1 AND l.objsubid = 1 AND l.granted
+	`, advisoryLockKey).Scan(&pid, &application, &client, &since)
+	if err != nil {
+		return "an unknown session"
+	}
+	return fmt.Sprintf("backend pid %d (application %q, client %s) connected since %s", pid, application, client, since.Format(time.RFC3339))
+}
+
+// lockSQLite claims the single row of schema_migrations_lock. A row is used
+// rather than BEGIN EXCLUSIVE because each migration runs in a transaction of
+// its own. The holder refreshes the row's heartbeat while it runs, so that the
+// row of a process that died expires and the next process takes it over.
+// While a migration holds the database's write lock the refresh fails as
+// busy, so each migration also refreshes it in its own transaction, see
+// heartbeatSQLite.
+func lockSQLite(ctx context.Context, db *sql.DB, timeout time.Duration, logf func(string, ...interface{})) (conn, func() error, error) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			holder TEXT NOT NULL,
+			acquired_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			heartbeat_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create schema_migrations_lock table: %w", err)
+	}
+	// Tables created before heartbeats lack the column
+	if rows, err := db.QueryContext(ctx, "SELECT heartbeat_at FROM schema_migrations_lock WHERE 1 = 0"); err == nil {
+		rows.Close()
+	} else if _, err := db.ExecContext(ctx, "ALTER TABLE schema_migrations_lock ADD COLUMN heartbeat_at TIMESTAMP"); err != nil {
+		return nil, nil, fmt.Errorf("failed to add heartbeat column: %w", err)
+	}
+
+	holder := lockHolder()
+	expiry := fmt.Sprintf("-%d seconds", int(lockExpiry.Seconds()))
+	deadline := time.Now().Add(timeout)
+	for {
+		// The database itself may be busy, so errors are retried as well.
+		// Timestamps are compared in SQL, in the format CURRENT_TIMESTAMP
+		// writes.
+		_, err := db.ExecContext(ctx, "DELETE FROM schema_migrations_lock WHERE id = 1 AND COALESCE(heartbeat_at, acquired_at) < datetime('now', ?)", expiry)
+		if err == nil {
+			var result sql.Result
+			result, err = db.ExecContext(ctx, "INSERT INTO schema_migrations_lock (id, holder) VALUES (1, ?) ON CONFLICT DO NOTHING", holder)
+			if err == nil {
+				if n, err := result.RowsAffected(); err == nil && n == 1 {
+					break
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, nil, err
+			}
+			var current string
+			var since time.Time
+			if err := db.QueryRowContext(ctx, "SELECT holder, acquired_at FROM schema_migrations_lock WHERE id = 1").Scan(&current, &since); err != nil {
+				return nil, nil, fmt.Errorf("timed out after %s waiting for the lock", timeout)
+			}
+			return nil, nil, fmt.Errorf("timed out after %s waiting for the lock held by %s since %s", timeout, current, since.Format(time.RFC3339))
+		}
+		if err := wait(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// A failed heartbeat is retried on the next tick, well
+				// before the row expires
+				if err := heartbeatSQLite(context.Background(), db); err != nil {
+					logf("Failed to refresh migration lock: %v", err)
+				}
+			}
+		}
+	}()
+
+	return db, func() error {
+		close(stop)
+		<-done
+		_, err := db.ExecContext(context.Background(), "DELETE FROM schema_migrations_lock WHERE id = 1 AND holder = ?", holder)
+		return err
+	}, nil
+}
+
+// heartbeatSQLite refreshes the lock row of this process. Migrations call it
+// in their transaction, where it can't be kept waiting by their own write
+// lock, and it commits with them.
+func heartbeatSQLite(ctx context.Context, tx execer) error {
+	_, err := tx.ExecContext(ctx, "UPDATE schema_migrations_lock SET heartbeat_at = CURRENT_TIMESTAMP WHERE id = 1 AND holder = ?", lockHolder())
+	return err
+}
+
+// unlockSQLite deletes the lock row, whoever holds it.
+func unlockSQLite(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM schema_migrations_lock")
+	if err != nil && strings.Contains(err.Error(), "no such table") {
+		return nil
+	}
+	return err
+}
+
+// unlockPostgres terminates the session holding the advisory lock, which
+// releases it along with any migration that session is running.
+func unlockPostgres(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		SELECT pg_terminate_backend(l.pid)
+		FROM pg_locks l
+		WHERE l.locktype = 'advisory' AND l.classid = 0 AND l.objid = $1 AND l.objsubid = 1 AND l.granted
+	`, advisoryLockKey)
+	return err
+}
+
+// ForceUnlock releases the migration lock held by another process, for when
+// it hangs while holding it. On Postgres this terminates its session.
+func (m *Migrator) ForceUnlock(ctx context.Context) error {
+	if err := m.dialect.Unlock(ctx, m.db); err != nil {
+		return fmt.Errorf("failed to release migration lock: %w", err)
+	}
+	m.logf("Released the migration lock")
+	return nil
+}
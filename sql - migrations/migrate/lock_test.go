@@ -0,0 +1,110 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLockSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	_, unlock, err := lockSQLite(ctx, db, 0, t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = lockSQLite(ctx, db, 0, t.Logf)
+	if err == nil || !strings.Contains(err.Error(), "held by "+lockHolder()) {
+		t.Fatalf("got %v, want the lock to be held", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, unlock, err = lockSQLite(ctx, db, 0, t.Logf)
+	if err != nil {
+		t.Fatalf("lock was not released: %v", err)
+	}
+	unlock()
+}
+
+func TestLockSQLiteTakesOverExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	// A row left by a process that died, in a table from before heartbeats
+	_, err := db.Exec(`
+		CREATE TABLE schema_migrations_lock (id INTEGER PRIMARY KEY CHECK (id = 1), holder TEXT NOT NULL, acquired_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_migrations_lock (id, holder, acquired_at) VALUES (1, 'gone (pid 1)', datetime('now', '-2 minutes'));
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, unlock, err := lockSQLite(ctx, db, 0, t.Logf)
+	if err != nil {
+		t.Fatalf("expired lock was not taken over: %v", err)
+	}
+	defer unlock()
+
+	// A row whose heartbeat is recent is kept
+	if _, err := db.Exec("UPDATE schema_migrations_lock SET holder = 'alive (pid 2)', acquired_at = datetime('now', '-2 minutes'), heartbeat_at = datetime('now', '-5 seconds')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := lockSQLite(ctx, db, 0, t.Logf); err == nil || !strings.Contains(err.Error(), "alive (pid 2)") {
+		t.Fatalf("got %v, want the lock to be held", err)
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	m := testMigrator(t, db, testFiles(), Options{})
+
+	// Nothing to release before the lock table exists
+	if err := m.ForceUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE schema_migrations_lock (id INTEGER PRIMARY KEY CHECK (id = 1), holder TEXT NOT NULL, acquired_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, heartbeat_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_migrations_lock (id, holder) VALUES (1, 'stuck (pid 3)');
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ForceUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("got %v after forcing the lock open", err)
+	}
+}
+
+func TestMigrationsRefreshSQLiteLock(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	// A migration that outlasts the expiry, while its write lock keeps the
+	// heartbeat from being refreshed
+	var expired bool
+	m := testMigrator(t, db, fstest.MapFS{}, Options{
+		GoMigrations: []Migration{{ID: 1, Name: "slow", Up: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE schema_migrations_lock SET heartbeat_at = datetime('now', '-2 minutes')")
+			return err
+		}}},
+		AfterMigration: func(ctx context.Context, migration Migration, up bool, elapsed time.Duration, err error) {
+			if err := db.QueryRowContext(ctx, "SELECT heartbeat_at < datetime('now', '-1 minute') FROM schema_migrations_lock").Scan(&expired); err != nil {
+				t.Error(err)
+			}
+		},
+	})
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if expired {
+		t.Error("the lock expired during the migration")
+	}
+}
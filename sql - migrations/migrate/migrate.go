@@ -0,0 +1,662 @@
+// Package migrate applies SQL and Go migrations to SQLite and Postgres
+// databases and records them in a schema_migrations table.
+//
+// Migrations are read from the root of an fs.FS as pairs of
+// <id>_<name>_up.sql and <id>_<name>_down.sql files. A file in the dialect's
+// subdirectory (sqlite or postgres) replaces the shared file of the same
+// name. IDs order the migrations; the command line tool uses timestamps.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A migration file containing this line runs outside of a transaction, for
+// statements such as CREATE INDEX CONCURRENTLY that can't run inside one.
+const noTransactionMarker = "-- migrate:no-transaction"
+
+// Migration is either a pair of SQL files or a pair of Go functions.
+type Migration struct {
+	ID       int
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	UpFile   string
+	DownFile string
+	Up       MigrationFunc
+	Down     MigrationFunc
+	// Squashes lists the IDs of the migrations a baseline made by Squash
+	// replaces
+	Squashes []int
+}
+
+// MigrationFunc changes the database with Go code, for migrations that can't
+// be written in SQL such as backfills or re-encrypting a column. It runs in
+// the same transaction that records the migration.
+type MigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+// Options configure a Migrator. Only Driver is required.
+type Options struct {
+	// Driver is the name db was opened with: sqlite3 or postgres
+	Driver string
+	// Seeds holds the seed files Seed runs, laid out like the migrations
+	Seeds fs.FS
+	// GoMigrations are merged with the SQL files; their IDs must not clash
+	GoMigrations []Migration
+	// AllowDrift warns instead of failing when applied migrations were
+	// modified or removed
+	AllowDrift bool
+	// OutOfOrder decides what happens to a pending migration whose ID is
+	// lower than that of an applied one, which happens when branches
+	// created migrations concurrently. It fails by default.
+	OutOfOrder OutOfOrderPolicy
+	// LockTimeout is how long to wait for another process to release the
+	// migration lock, a minute by default
+	LockTimeout time.Duration
+	// DryRun writes the SQL that would run to Output instead of running it.
+	// It takes no lock and writes nothing, not even the tracking table.
+	DryRun bool
+	// Output receives dry run SQL, os.Stdout by default
+	Output io.Writer
+	// ScratchDB is a Postgres database that Verify and Diff may create and
+	// drop schemas in. It must not be the database being migrated.
+	// SQLite uses an in-memory database instead.
+	ScratchDB *sql.DB
+	// Logf receives progress messages; they are discarded when it is nil
+	Logf func(format string, args ...interface{})
+	// BeforeMigration and AfterMigration are called around every migration
+	// that runs, with up false when it is rolled back
+	BeforeMigration func(ctx context.Context, migration Migration, up bool)
+	AfterMigration  func(ctx context.Context, migration Migration, up bool, elapsed time.Duration, err error)
+}
+
+// OutOfOrderPolicy is what Up does with pending migrations older than the
+// last applied one.
+type OutOfOrderPolicy string
+
+const (
+	OutOfOrderError OutOfOrderPolicy = "error"
+	OutOfOrderAllow OutOfOrderPolicy = "allow"
+	OutOfOrderWarn  OutOfOrderPolicy = "warn"
+)
+
+// Migrator applies the migrations of one fs.FS to one database.
+type Migrator struct {
+	db      *sql.DB
+	conn    conn
+	fsys    fs.FS
+	opts    Options
+	dialect dialect
+	// scratch migrators run on a throwaway database and take no lock
+	scratch bool
+	// untracked is set on a dry run of a database without a
+	// schema_migrations table, which then has no applied migrations, and
+	// noChecksums when the table predates the checksum columns
+	untracked   bool
+	noChecksums bool
+}
+
+// conn is implemented by *sql.DB and by the *sql.Conn of a scratch database.
+type conn interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// New returns a Migrator for db, reading migrations from fsys.
+func New(db *sql.DB, fsys fs.FS, opts Options) (*Migrator, error) {
+	d, ok := dialects[opts.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver %q", opts.Driver)
+	}
+	switch opts.OutOfOrder {
+	case "":
+		opts.OutOfOrder = OutOfOrderError
+	case OutOfOrderError, OutOfOrderAllow, OutOfOrderWarn:
+	default:
+		return nil, fmt.Errorf("unknown out-of-order policy %q", opts.OutOfOrder)
+	}
+	if opts.LockTimeout == 0 {
+		opts.LockTimeout = time.Minute
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	return &Migrator{db: db, conn: db, fsys: fsys, opts: opts, dialect: d}, nil
+}
+
+func (m *Migrator) logf(format string, args ...interface{}) {
+	if m.opts.Logf != nil {
+		m.opts.Logf(format, args...)
+	}
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpTo(ctx, 0)
+}
+
+// UpTo applies pending migrations in order, stopping after the migration
+// with the given ID when it isn't 0.
+func (m *Migrator) UpTo(ctx context.Context, id int) error {
+	return m.run(ctx, func(migrations []Migration) error {
+		return m.upTo(ctx, migrations, id)
+	})
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.Rollback(ctx, 1)
+}
+
+// Rollback rolls back the last count applied migrations.
+func (m *Migrator) Rollback(ctx context.Context, count int) error {
+	return m.run(ctx, func(migrations []Migration) error {
+		return m.rollback(ctx, migrations, count)
+	})
+}
+
+// DownTo rolls back every applied migration after the one with the given ID,
+// or every applied migration when it is 0.
+func (m *Migrator) DownTo(ctx context.Context, id int) error {
+	return m.run(ctx, func(migrations []Migration) error {
+		return m.downTo(ctx, migrations, id)
+	})
+}
+
+// To migrates up or down until the migration with the given ID is the last
+// one applied. To(ctx, 0) rolls back everything.
+func (m *Migrator) To(ctx context.Context, id int) error {
+	return m.run(ctx, func(migrations []Migration) error {
+		applied, err := m.loadApplied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, a := range applied {
+			if a.ID == id {
+				return m.downTo(ctx, migrations, id)
+			}
+		}
+		if id == 0 {
+			return m.downTo(ctx, migrations, 0)
+		}
+		return m.upTo(ctx, migrations, id)
+	})
+}
+
+// Redo rolls back the last applied migration and applies it again, which
+// helps while iterating on a migration that is still in development.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.run(ctx, func(migrations []Migration) error {
+		applied, err := m.loadApplied(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return fmt.Errorf("no migrations to redo")
+		}
+		migration := findMigration(migrations, applied[len(applied)-1].ID)
+		if migration == nil {
+			return fmt.Errorf("migration %d not found", applied[len(applied)-1].ID)
+		}
+
+		if err := m.rollback(ctx, migrations, 1); err != nil {
+			return err
+		}
+		if m.opts.DryRun {
+			// The migration is still recorded, so apply would skip it
+			m.printSQL(*migration, true)
+			return nil
+		}
+		return m.apply(ctx, *migration)
+	})
+}
+
+// run holds the migration lock while fn changes the database, after
+// creating the tracking table and comparing applied migrations with their
+// files. Dry runs only read, so they skip the lock. Everything fn does runs
+// on the connection the lock returns.
+func (m *Migrator) run(ctx context.Context, fn func(migrations []Migration) error) error {
+	if !m.scratch && !m.opts.DryRun {
+		locked, unlock, err := m.dialect.Lock(ctx, m.db, m.opts.LockTimeout, m.logf)
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		m.conn = locked
+		defer func() {
+			m.conn = m.db
+			if err := unlock(); err != nil {
+				m.logf("Failed to release migration lock: %v", err)
+			}
+		}()
+	}
+
+	migrations, err := m.prepare(ctx)
+	if err != nil {
+		return err
+	}
+	problems, err := m.verifyChecksums(ctx, migrations)
+	if err != nil {
+		return fmt.Errorf("failed to verify migrations: %w", err)
+	}
+	for _, problem := range problems {
+		m.logf("Warning: %s", problem)
+	}
+	if len(problems) > 0 && !m.opts.AllowDrift {
+		return fmt.Errorf("applied migrations differ from their files; restore them or allow drift")
+	}
+	return fn(migrations)
+}
+
+// readOnly returns a copy of m that reads the tracking table the way a dry
+// run does, leaving it as it is.
+func (m *Migrator) readOnly() *Migrator {
+	r := *m
+	r.opts.DryRun = true
+	return &r
+}
+
+// prepare creates the tracking table and loads the migrations. A dry run
+// leaves a missing table or missing columns as they are.
+func (m *Migrator) prepare(ctx context.Context) ([]Migration, error) {
+	if m.opts.DryRun {
+		m.untracked = !m.hasColumn(ctx, "id")
+		m.noChecksums = m.untracked || !m.hasColumn(ctx, "up_checksum") || !m.hasColumn(ctx, "down_checksum")
+		return m.loadMigrations(ctx)
+	}
+
+	m.untracked, m.noChecksums = false, false
+	_, err := m.conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			id BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			up_checksum TEXT,
+			down_checksum TEXT
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	if err := m.ensureChecksumColumns(ctx); err != nil {
+		return nil, fmt.Errorf("failed to add checksum columns: %w", err)
+	}
+	return m.loadMigrations(ctx)
+}
+
+// loadMigrations loads the migrations and swaps the records of squashed
+// ones for their baseline's.
+func (m *Migrator) loadMigrations(ctx context.Context) ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if err := m.reconcileSquashed(ctx, migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// Migrations returns the SQL and Go migrations sorted by ID.
+func (m *Migrator) Migrations() ([]Migration, error) {
+	// Read the shared SQL files, then the dialect's own, which take precedence
+	files := map[string]string{}
+	for _, dir := range []string{".", m.dialect.Dir} {
+		entries, err := fs.ReadDir(m.fsys, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files[entry.Name()] = path.Join(dir, entry.Name())
+			}
+		}
+	}
+
+	// Parse migration files
+	migrationsMap := map[int]*Migration{}
+	for name, file := range files {
+		parts := strings.SplitN(name, "_", -1)
+		if len(parts) < 3 {
+			continue
+		}
+
+		// Extract ID and type (up/down)
+		id := parts[0]
+		title := strings.Join(parts[1:len(parts)-1], "_")
+		migrationType := parts[len(parts)-1]
+
+		migrationID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration ID in file %s: %w", name, err)
+		}
+
+		// Read the SQL content
+		content, err := fs.ReadFile(m.fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", name, err)
+		}
+
+		// Add or update the migration
+		if _, exists := migrationsMap[migrationID]; !exists {
+			migrationsMap[migrationID] = &Migration{
+				ID:   migrationID,
+				Name: title,
+			}
+		}
+
+		if migrationType == "up.sql" {
+			migrationsMap[migrationID].UpSQL = string(content)
+			migrationsMap[migrationID].UpFile = file
+			squashes, err := parseSquashes(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("invalid squash marker in file %s: %w", name, err)
+			}
+			migrationsMap[migrationID].Squashes = squashes
+		} else if migrationType == "down.sql" {
+			migrationsMap[migrationID].DownSQL = string(content)
+			migrationsMap[migrationID].DownFile = file
+		}
+	}
+
+	// Merge the Go migrations
+	for _, migration := range m.opts.GoMigrations {
+		if _, exists := migrationsMap[migration.ID]; exists {
+			return nil, fmt.Errorf("migration %d is defined twice", migration.ID)
+		}
+		migration := migration
+		migrationsMap[migration.ID] = &migration
+	}
+
+	// Convert map to slice and sort by ID
+	migrations := make([]Migration, 0, len(migrationsMap))
+	for _, migration := range migrationsMap {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].ID < migrations[j].ID
+	})
+
+	return migrations, nil
+}
+
+func (m *Migrator) upTo(ctx context.Context, migrations []Migration, to int) error {
+	if to != 0 && findMigration(migrations, to) == nil {
+		return fmt.Errorf("migration %d not found", to)
+	}
+	if err := m.checkOrder(ctx, migrations, to); err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if to != 0 && migration.ID > to {
+			break
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+// checkOrder applies the out-of-order policy to the pending migrations up to
+// the given ID that are older than the last applied migration.
+func (m *Migrator) checkOrder(ctx context.Context, migrations []Migration, to int) error {
+	if m.opts.OutOfOrder == OutOfOrderAllow {
+		return nil
+	}
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	last := applied[len(applied)-1]
+	appliedIDs := map[int]bool{}
+	for _, a := range applied {
+		appliedIDs[a.ID] = true
+	}
+
+	var outOfOrder []string
+	for _, migration := range migrations {
+		if migration.ID > last.ID || (to != 0 && migration.ID > to) {
+			break
+		}
+		if !appliedIDs[migration.ID] {
+			outOfOrder = append(outOfOrder, fmt.Sprintf("%d (%s)", migration.ID, migration.Name))
+		}
+	}
+	if len(outOfOrder) == 0 {
+		return nil
+	}
+	if m.opts.OutOfOrder == OutOfOrderWarn {
+		m.logf("Warning: applying migrations older than the last applied migration %d (%s): %s", last.ID, last.Name, strings.Join(outOfOrder, ", "))
+		return nil
+	}
+	return fmt.Errorf("pending migrations are older than the last applied migration %d (%s): %s; rename them to a later ID or allow out-of-order migrations",
+		last.ID, last.Name, strings.Join(outOfOrder, ", "))
+}
+
+func (m *Migrator) downTo(ctx context.Context, migrations []Migration, to int) error {
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return err
+	}
+	count, found := 0, to == 0
+	for _, a := range applied {
+		if a.ID == to {
+			found = true
+		} else if a.ID > to {
+			count++
+		}
+	}
+	if !found {
+		return fmt.Errorf("migration %d is not applied", to)
+	}
+	if count == 0 {
+		m.logf("Already at migration %d", to)
+		return nil
+	}
+	return m.rollback(ctx, migrations, count)
+}
+
+// runInTransaction runs fn inside a transaction when the driver supports
+// transactional DDL and the SQL hasn't opted out, so that a failing
+// migration leaves neither partial changes nor a bookkeeping row behind.
+// Go migrations always run in a transaction, which they receive as *sql.Tx.
+func (m *Migrator) runInTransaction(ctx context.Context, migrationSQL string, goFunc MigrationFunc, fn func(execer) error) error {
+	if goFunc == nil && (!m.dialect.TransactionalDDL || strings.Contains(migrationSQL, noTransactionMarker)) {
+		return fn(m.conn)
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// execMigration runs the Go function of one direction of a migration, or
+// else the statements of its SQL one at a time, so that a failure names the
+// statement. runInTransaction always passes Go functions a transaction.
+func execMigration(ctx context.Context, tx execer, driver, file, migrationSQL string, goFunc MigrationFunc) error {
+	if goFunc != nil {
+		return goFunc(ctx, tx.(*sql.Tx))
+	}
+
+	statements, err := splitStatements(driver, migrationSQL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for i, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.SQL); err != nil {
+			return fmt.Errorf("%s: statement %d (line %d): %w", file, i+1, statement.Line, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	// Check if the migration has already been applied
+	exists := false
+	if !m.untracked {
+		err := m.conn.QueryRowContext(ctx, m.dialect.rebind("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE id = ?)"), migration.ID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check migration: %w", err)
+		}
+	}
+	if exists {
+		m.logf("Migration %d (%s) already applied", migration.ID, migration.Name)
+		return nil
+	}
+
+	if m.opts.DryRun {
+		m.printSQL(migration, true)
+		return nil
+	}
+
+	// Apply the migration and record it as applied
+	m.logf("Applying migration %d (%s)...", migration.ID, migration.Name)
+	err := m.hooked(ctx, migration, true, func() error {
+		return m.runInTransaction(ctx, migration.UpSQL, migration.Up, func(tx execer) error {
+			if err := execMigration(ctx, tx, m.opts.Driver, migration.UpFile, migration.UpSQL, migration.Up); err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+			}
+
+			_, err := tx.ExecContext(ctx, m.dialect.rebind("INSERT INTO schema_migrations (id, name, applied_at, up_checksum, down_checksum) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)"),
+				migration.ID, migration.Name, checksum(migration.UpSQL), checksum(migration.DownSQL))
+			if err != nil {
+				return fmt.Errorf("failed to record migration: %w", err)
+			}
+			return m.heartbeat(ctx, tx)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	m.logf("Migration %d (%s) applied successfully", migration.ID, migration.Name)
+	return nil
+}
+
+func (m *Migrator) rollback(ctx context.Context, migrations []Migration, count int) error {
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return err
+	}
+	var migrationIDs []int
+	for i := len(applied) - 1; i >= 0 && len(migrationIDs) < count; i-- {
+		migrationIDs = append(migrationIDs, applied[i].ID)
+	}
+
+	if len(migrationIDs) == 0 {
+		return fmt.Errorf("no migrations to rollback")
+	}
+
+	for _, id := range migrationIDs {
+		migration := findMigration(migrations, id)
+		if migration == nil {
+			return fmt.Errorf("migration %d not found", id)
+		}
+
+		if m.opts.DryRun {
+			m.printSQL(*migration, false)
+			continue
+		}
+
+		m.logf("Rolling back migration %d (%s)...", migration.ID, migration.Name)
+		err := m.hooked(ctx, *migration, false, func() error {
+			return m.runInTransaction(ctx, migration.DownSQL, migration.Down, func(tx execer) error {
+				if err := execMigration(ctx, tx, m.opts.Driver, migration.DownFile, migration.DownSQL, migration.Down); err != nil {
+					return fmt.Errorf("failed to rollback migration %d: %w", migration.ID, err)
+				}
+
+				_, err := tx.ExecContext(ctx, m.dialect.rebind("DELETE FROM schema_migrations WHERE id = ?"), migration.ID)
+				if err != nil {
+					return fmt.Errorf("failed to delete migration record %d: %w", migration.ID, err)
+				}
+				return m.heartbeat(ctx, tx)
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		m.logf("Migration %d (%s) rolled back successfully", migration.ID, migration.Name)
+	}
+	return nil
+}
+
+// heartbeat refreshes the migration lock as part of a migration, so that it
+// commits fresh however long the migration took.
+func (m *Migrator) heartbeat(ctx context.Context, tx execer) error {
+	if m.scratch || m.dialect.Heartbeat == nil {
+		return nil
+	}
+	if err := m.dialect.Heartbeat(ctx, tx); err != nil {
+		return fmt.Errorf("failed to refresh migration lock: %w", err)
+	}
+	return nil
+}
+
+// hooked calls the BeforeMigration and AfterMigration hooks around fn.
+func (m *Migrator) hooked(ctx context.Context, migration Migration, up bool, fn func() error) error {
+	if m.opts.BeforeMigration != nil {
+		m.opts.BeforeMigration(ctx, migration, up)
+	}
+	start := time.Now()
+	err := fn()
+	if m.opts.AfterMigration != nil {
+		m.opts.AfterMigration(ctx, migration, up, time.Since(start), err)
+	}
+	return err
+}
+
+// printSQL shows the SQL a dry run would execute for one direction of a
+// migration. Go migrations can only be named.
+func (m *Migrator) printSQL(migration Migration, up bool) {
+	direction, migrationSQL, goFunc := "up", migration.UpSQL, migration.Up
+	if !up {
+		direction, migrationSQL, goFunc = "down", migration.DownSQL, migration.Down
+	}
+	if goFunc != nil {
+		migrationSQL = "-- runs Go code"
+	}
+	fmt.Fprintf(m.opts.Output, "-- %s: migration %d (%s)\n%s\n\n", direction, migration.ID, migration.Name, strings.TrimSpace(migrationSQL))
+}
+
+func findMigration(migrations []Migration, id int) *Migration {
+	for i := range migrations {
+		if migrations[i].ID == id {
+			return &migrations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testFiles holds two migrations: a users table, then a posts table
+// referencing it.
+func testFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"1_users_up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);")},
+		"1_users_down.sql": {Data: []byte("DROP TABLE users;")},
+		"2_posts_up.sql":   {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id));")},
+		"2_posts_down.sql": {Data: []byte("DROP TABLE posts;")},
+	}
+}
+
+// testDB opens a private in-memory SQLite database. It is limited to one
+// connection, as every connection to :memory: opens a database of its own.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS, opts Options) *Migrator {
+	t.Helper()
+	opts.Driver = "sqlite3"
+	m, err := New(db, fsys, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// tables lists the tables of db, bookkeeping included.
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func appliedIDs(t *testing.T, m *Migrator) []int {
+	t.Helper()
+	applied, err := m.loadApplied(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, a := range applied {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	m := testMigrator(t, db, testFiles(), Options{})
+
+	if err := m.UpTo(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("got applied %v after up to 1, want [1]", got)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"posts", "schema_migrations", "schema_migrations_lock", "users"}
+	if got := tables(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("got tables %v, want %v", got, want)
+	}
+
+	if err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("got applied %v after down, want [1]", got)
+	}
+	if err := m.To(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"schema_migrations", "schema_migrations_lock"}
+	if got := tables(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("got tables %v, want %v", got, want)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	files := testFiles()
+	files["2_posts_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY);\nINSERT INTO missing VALUES (1);")}
+	m := testMigrator(t, db, files, Options{})
+
+	err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "2_posts_up.sql: statement 2 (line 2)") {
+		t.Fatalf("got %v, want an error naming the statement", err)
+	}
+	if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("got applied %v, want [1]", got)
+	}
+	for _, table := range tables(t, db) {
+		if table == "posts" {
+			t.Error("the failed migration left its table behind")
+		}
+	}
+}
+
+func TestDryRunIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("new database", func(t *testing.T) {
+		db := testDB(t)
+		out := &bytes.Buffer{}
+		m := testMigrator(t, db, testFiles(), Options{DryRun: true, Output: out})
+
+		if err := m.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "-- up: migration 1 (users)") || !strings.Contains(out.String(), "-- up: migration 2 (posts)") {
+			t.Errorf("got output\n%s\nwant both migrations", out)
+		}
+		if got := tables(t, db); len(got) != 0 {
+			t.Errorf("dry run created tables %v", got)
+		}
+
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.State != Pending {
+				t.Errorf("migration %d is %s, want pending", s.ID, s.State)
+			}
+		}
+		if got := tables(t, db); len(got) != 0 {
+			t.Errorf("dry run status created tables %v", got)
+		}
+
+		if err := m.Down(ctx); err == nil || !strings.Contains(err.Error(), "no migrations to rollback") {
+			t.Errorf("got %v, want no migrations to roll back", err)
+		}
+	})
+
+	t.Run("legacy table", func(t *testing.T) {
+		db := testDB(t)
+		_, err := db.Exec(`
+			CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);
+			CREATE TABLE schema_migrations (id BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+			INSERT INTO schema_migrations (id, name) VALUES (1, 'users');
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		m := testMigrator(t, db, testFiles(), Options{DryRun: true, Output: out})
+
+		if err := m.Rollback(ctx, 5); err != nil {
+			t.Fatal(err)
+		}
+		if want := "-- down: migration 1 (users)\nDROP TABLE users;\n\n"; out.String() != want {
+			t.Errorf("got output\n%s\nwant\n%s", out, want)
+		}
+		if got, want := tables(t, db), []string{"schema_migrations", "users"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got tables %v, want %v", got, want)
+		}
+		if m.hasColumn(ctx, "up_checksum") {
+			t.Error("dry run added the checksum columns")
+		}
+
+		// A real run adopts the checksums of the current files
+		m.opts.DryRun = false
+		if err := m.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var sum sql.NullString
+		if err := db.QueryRow("SELECT up_checksum FROM schema_migrations WHERE id = 1").Scan(&sum); err != nil {
+			t.Fatal(err)
+		}
+		if sum.String != checksum("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);") {
+			t.Errorf("got checksum %v, want that of the up file", sum)
+		}
+	})
+}
+
+func TestStatusIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	db := testDB(t)
+	statuses, err := testMigrator(t, db, testFiles(), Options{}).Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].State != Pending || statuses[1].State != Pending {
+		t.Errorf("got statuses %+v, want two pending", statuses)
+	}
+	if got := tables(t, db); len(got) != 0 {
+		t.Errorf("status created tables %v", got)
+	}
+
+	legacy := testDB(t)
+	_, err = legacy.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);
+		CREATE TABLE schema_migrations (id BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_migrations (id, name) VALUES (1, 'users');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := testMigrator(t, legacy, testFiles(), Options{})
+	statuses, err = m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].State != Applied || statuses[1].State != Pending {
+		t.Errorf("got statuses %+v, want 1 applied and 2 pending", statuses)
+	}
+	if m.hasColumn(ctx, "up_checksum") {
+		t.Error("status added the checksum columns")
+	}
+
+	if _, _, err := m.Diff(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);"); err != nil {
+		t.Fatal(err)
+	}
+	if m.hasColumn(ctx, "up_checksum") {
+		t.Error("diff added the checksum columns")
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	db := testDB(t)
+	if _, err := New(db, testFiles(), Options{Driver: "mysql"}); err == nil {
+		t.Error("got no error for an unsupported driver")
+	}
+	if _, err := New(db, testFiles(), Options{Driver: "sqlite3", OutOfOrder: "sometimes"}); err == nil {
+		t.Error("got no error for an unknown out-of-order policy")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	files := testFiles()
+	files["2_posts_down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE missing;")}
+
+	var calls []string
+	m := testMigrator(t, testDB(t), files, Options{
+		BeforeMigration: func(ctx context.Context, migration Migration, up bool) {
+			calls = append(calls, fmt.Sprintf("before %d %t", migration.ID, up))
+		},
+		AfterMigration: func(ctx context.Context, migration Migration, up bool, elapsed time.Duration, err error) {
+			calls = append(calls, fmt.Sprintf("after %d %t %t", migration.ID, up, err == nil))
+		},
+	})
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(ctx); err == nil {
+		t.Fatal("got no error rolling back with a failing down migration")
+	}
+
+	want := []string{
+		"before 1 true", "after 1 true true",
+		"before 2 true", "after 2 true true",
+		"before 2 false", "after 2 false false",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+}
+
+func TestNoTransactionMarker(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	files := fstest.MapFS{
+		"1_users_up.sql":   {Data: []byte(noTransactionMarker + "\nCREATE TABLE users (id INTEGER PRIMARY KEY);\nINSERT INTO missing VALUES (1);")},
+		"1_users_down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	m := testMigrator(t, db, files, Options{})
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("got no error from a failing migration")
+	}
+	// Statements before the failure stay, and the migration isn't recorded
+	if got, want := tables(t, db), []string{"schema_migrations", "schema_migrations_lock", "users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got tables %v, want %v", got, want)
+	}
+	if got := appliedIDs(t, m); len(got) != 0 {
+		t.Errorf("got applied %v, want none", got)
+	}
+}
@@ -0,0 +1,340 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dbSchema is the part of a database schema that diff compares: tables with
+// their columns and constraints, and indexes.
+type dbSchema struct {
+	Tables  []*schemaTable
+	Indexes []schemaIndex
+}
+
+type schemaTable struct {
+	Name    string
+	Columns []schemaColumn
+	// Constraints are keyed by name on Postgres. SQLite constraints have no
+	// names, so its foreign keys and unique constraints are keyed by their
+	// definition.
+	Constraints map[string]schemaConstraint
+	// Create is the statement creating the table as SQLite stores it; it is
+	// empty on Postgres, where createTable builds it.
+	Create string
+}
+
+type schemaColumn struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Default sql.NullString
+}
+
+type schemaConstraint struct {
+	Definition string
+	ForeignKey bool
+	// References is the table a foreign key references
+	References string
+}
+
+type schemaIndex struct {
+	Name   string
+	Table  string
+	Create string
+}
+
+func (s *dbSchema) table(name string) *schemaTable {
+	for _, t := range s.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *dbSchema) index(name string) *schemaIndex {
+	for i := range s.Indexes {
+		if s.Indexes[i].Name == name {
+			return &s.Indexes[i]
+		}
+	}
+	return nil
+}
+
+func (t *schemaTable) column(name string) *schemaColumn {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// definition renders the column as it appears in CREATE TABLE and ADD COLUMN.
+func (c schemaColumn) definition() string {
+	def := c.Name + " " + c.Type
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	if c.Default.Valid {
+		def += " DEFAULT " + c.Default.String
+	}
+	return def
+}
+
+// isBookkeeping reports whether a table belongs to the migrations runner.
+func isBookkeeping(table string) bool {
+	return table == "schema_migrations" || table == "schema_migrations_lock" || table == "schema_seeds"
+}
+
+// readSchema introspects the tables, constraints and indexes of a database.
+func readSchema(ctx context.Context, c conn, driver string) (*dbSchema, error) {
+	if driver == "postgres" {
+		return readPostgresSchema(ctx, c)
+	}
+	return readSQLiteSchema(ctx, c)
+}
+
+func readSQLiteSchema(ctx context.Context, c conn) (*dbSchema, error) {
+	s := &dbSchema{}
+	rows, err := c.QueryContext(ctx, `
+		SELECT type, name, tbl_name, sql FROM sqlite_master
+		WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%' AND sql IS NOT NULL
+		ORDER BY rowid
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	for rows.Next() {
+		var kind, name, table, create string
+		if err := rows.Scan(&kind, &name, &table, &create); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if isBookkeeping(table) {
+			continue
+		}
+		if kind == "table" {
+			s.Tables = append(s.Tables, &schemaTable{Name: name, Create: create, Constraints: map[string]schemaConstraint{}})
+		} else {
+			s.Indexes = append(s.Indexes, schemaIndex{Name: name, Table: table, Create: create})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range s.Tables {
+		columns, err := c.QueryContext(ctx, "SELECT name, type, \"notnull\", dflt_value FROM pragma_table_info(?) ORDER BY cid", t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %w", t.Name, err)
+		}
+		for columns.Next() {
+			var column schemaColumn
+			if err := columns.Scan(&column.Name, &column.Type, &column.NotNull, &column.Default); err != nil {
+				columns.Close()
+				return nil, err
+			}
+			t.Columns = append(t.Columns, column)
+		}
+		columns.Close()
+
+		keys, err := c.QueryContext(ctx, `
+			SELECT "table", group_concat("from", ', '), group_concat(COALESCE("to", ''), ', ')
+			FROM (SELECT * FROM pragma_foreign_key_list(?) ORDER BY id, seq) GROUP BY id
+		`, t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of %s: %w", t.Name, err)
+		}
+		for keys.Next() {
+			var refTable, from, to string
+			if err := keys.Scan(&refTable, &from, &to); err != nil {
+				keys.Close()
+				return nil, err
+			}
+			def := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", from, refTable, to)
+			t.Constraints[def] = schemaConstraint{Definition: def, ForeignKey: true, References: refTable}
+		}
+		keys.Close()
+
+		unique, err := c.QueryContext(ctx, `
+			SELECT (SELECT group_concat(name, ', ') FROM (SELECT name FROM pragma_index_info(il.name) ORDER BY seqno))
+			FROM pragma_index_list(?) il WHERE il.origin = 'u'
+		`, t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read unique constraints of %s: %w", t.Name, err)
+		}
+		for unique.Next() {
+			var columns string
+			if err := unique.Scan(&columns); err != nil {
+				unique.Close()
+				return nil, err
+			}
+			def := fmt.Sprintf("UNIQUE (%s)", columns)
+			t.Constraints[def] = schemaConstraint{Definition: def}
+		}
+		unique.Close()
+	}
+	return s, nil
+}
+
+func readPostgresSchema(ctx context.Context, c conn) (*dbSchema, error) {
+	s := &dbSchema{}
+	rows, err := c.QueryContext(ctx, `
+		SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull, pg_get_expr(d.adbin, d.adrelid)
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND c.relkind = 'r' AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var column schemaColumn
+		if err := rows.Scan(&table, &column.Name, &column.Type, &column.NotNull, &column.Default); err != nil {
+			return nil, err
+		}
+		if isBookkeeping(table) {
+			continue
+		}
+		t := s.table(table)
+		if t == nil {
+			t = &schemaTable{Name: table, Constraints: map[string]schemaConstraint{}}
+			s.Tables = append(s.Tables, t)
+		}
+
+		// Columns declared serial own a sequence named after them
+		if column.Default.String == fmt.Sprintf("nextval('%s_%s_seq'::regclass)", table, column.Name) {
+			if serial, ok := map[string]string{"smallint": "smallserial", "integer": "serial", "bigint": "bigserial"}[column.Type]; ok {
+				column.Type, column.Default = serial, sql.NullString{}
+			}
+		}
+		t.Columns = append(t.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	constraints, err := c.QueryContext(ctx, `
+		SELECT t.relname, c.conname, c.contype = 'f', pg_get_constraintdef(c.oid), COALESCE(r.relname, '')
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		LEFT JOIN pg_class r ON r.oid = c.confrelid
+		WHERE n.nspname = current_schema() AND c.contype IN ('p', 'u', 'f', 'c', 'x')
+		ORDER BY t.relname, c.conname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read constraints: %w", err)
+	}
+	defer constraints.Close()
+
+	for constraints.Next() {
+		var table, name string
+		var constraint schemaConstraint
+		if err := constraints.Scan(&table, &name, &constraint.ForeignKey, &constraint.Definition, &constraint.References); err != nil {
+			return nil, err
+		}
+		if t := s.table(table); t != nil {
+			t.Constraints[name] = constraint
+		}
+	}
+	if err := constraints.Err(); err != nil {
+		return nil, err
+	}
+
+	// Indexes backing constraints are created along with them
+	indexes, err := c.QueryContext(ctx, `
+		SELECT i.relname, t.relname, pg_get_indexdef(i.oid)
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = current_schema()
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = x.indexrelid)
+		ORDER BY t.relname, i.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer indexes.Close()
+
+	for indexes.Next() {
+		var index schemaIndex
+		if err := indexes.Scan(&index.Name, &index.Table, &index.Create); err != nil {
+			return nil, err
+		}
+		if !isBookkeeping(index.Table) {
+			s.Indexes = append(s.Indexes, index)
+		}
+	}
+	return s, indexes.Err()
+}
+
+// createTable returns the statement creating t. Postgres foreign keys are
+// left out so that tables can be created in any order; see foreignKeys.
+func createTable(driver string, t *schemaTable) string {
+	if driver != "postgres" {
+		return t.Create
+	}
+
+	var lines []string
+	for _, c := range t.Columns {
+		lines = append(lines, "  "+c.definition())
+	}
+	for _, name := range sortedConstraints(t) {
+		if c := t.Constraints[name]; !c.ForeignKey {
+			lines = append(lines, fmt.Sprintf("  CONSTRAINT %s %s", name, c.Definition))
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)", t.Name, strings.Join(lines, ",\n"))
+}
+
+// foreignKeys returns the statements adding t's foreign keys on Postgres.
+func foreignKeys(driver string, t *schemaTable) []string {
+	if driver != "postgres" {
+		return nil
+	}
+	var statements []string
+	for _, name := range sortedConstraints(t) {
+		if c := t.Constraints[name]; c.ForeignKey {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", t.Name, name, c.Definition))
+		}
+	}
+	return statements
+}
+
+func sortedConstraints(t *schemaTable) []string {
+	names := make([]string, 0, len(t.Constraints))
+	for name := range t.Constraints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// schemaStatements returns the statements recreating the whole schema.
+func schemaStatements(driver string, s *dbSchema) []string {
+	var statements []string
+	for _, t := range s.Tables {
+		statements = append(statements, createTable(driver, t))
+	}
+	for _, t := range s.Tables {
+		statements = append(statements, foreignKeys(driver, t)...)
+	}
+	for _, index := range s.Indexes {
+		statements = append(statements, index.Create)
+	}
+	return statements
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A seed file containing this line followed by environment names only runs
+// in those environments. Seeds without it run in every environment.
+const envMarker = "-- migrate:env"
+
+// seed is one file of reference rows. Seeds must be idempotent, using
+// INSERT ... ON CONFLICT DO NOTHING or similar, because they run again
+// whenever they change.
+type seed struct {
+	Name string
+	File string
+	SQL  string
+	Envs []string
+}
+
+func (s seed) runsIn(env string) bool {
+	if len(s.Envs) == 0 {
+		return true
+	}
+	for _, e := range s.Envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// seeds reads the .sql files of Options.Seeds sorted by name. As with
+// migrations, a file in the dialect's subdirectory replaces the shared file
+// of the same name.
+func (m *Migrator) seeds() ([]seed, error) {
+	if m.opts.Seeds == nil {
+		return nil, fmt.Errorf("no seeds configured")
+	}
+
+	files := map[string]string{}
+	for _, dir := range []string{".", m.dialect.Dir} {
+		entries, err := fs.ReadDir(m.opts.Seeds, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read seeds directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+				files[entry.Name()] = path.Join(dir, entry.Name())
+			}
+		}
+	}
+
+	var seeds []seed
+	for name, file := range files {
+		content, err := fs.ReadFile(m.opts.Seeds, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", name, err)
+		}
+		s := seed{Name: strings.TrimSuffix(name, ".sql"), File: file, SQL: string(content)}
+		for _, line := range strings.Split(s.SQL, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, envMarker) {
+				s.Envs = strings.Fields(strings.TrimPrefix(line, envMarker))
+				break
+			}
+		}
+		seeds = append(seeds, s)
+	}
+	sort.Slice(seeds, func(i, j int) bool {
+		return seeds[i].Name < seeds[j].Name
+	})
+	return seeds, nil
+}
+
+// Seed runs the seeds of the given environment that haven't run since they
+// last changed, recording them in schema_seeds rather than
+// schema_migrations so that seeding never affects which migrations are
+// applied.
+func (m *Migrator) Seed(ctx context.Context, env string) error {
+	if env == "" {
+		return fmt.Errorf("no environment given")
+	}
+	return m.run(ctx, func(migrations []Migration) error {
+		applied, err := m.loadApplied(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) < len(migrations) {
+			m.logf("Warning: %d migrations are pending; seeds may expect tables they create", len(migrations)-len(applied))
+		}
+
+		seeds, err := m.seeds()
+		if err != nil {
+			return err
+		}
+		// A dry run doesn't create the table, and without it every seed runs
+		tracked := true
+		if m.opts.DryRun {
+			rows, err := m.conn.QueryContext(ctx, "SELECT 1 FROM schema_seeds WHERE 1 = 0")
+			if err == nil {
+				rows.Close()
+			}
+			tracked = err == nil
+		} else {
+			_, err = m.conn.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS schema_seeds (
+					name TEXT NOT NULL,
+					env TEXT NOT NULL,
+					checksum TEXT NOT NULL,
+					applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (name, env)
+				);
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to create schema_seeds table: %w", err)
+			}
+		}
+
+		ran := 0
+		for _, s := range seeds {
+			if !s.runsIn(env) {
+				continue
+			}
+			if tracked {
+				var previous string
+				err := m.conn.QueryRowContext(ctx, m.dialect.rebind("SELECT checksum FROM schema_seeds WHERE name = ? AND env = ?"), s.Name, env).Scan(&previous)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("failed to check seed %s: %w", s.Name, err)
+				}
+				if previous == checksum(s.SQL) {
+					continue
+				}
+			}
+
+			if m.opts.DryRun {
+				fmt.Fprintf(m.opts.Output, "-- seed: %s (%s)\n%s\n\n", s.Name, env, strings.TrimSpace(s.SQL))
+				continue
+			}
+			m.logf("Seeding %s (%s)...", s.Name, env)
+			err := m.runInTransaction(ctx, s.SQL, nil, func(tx execer) error {
+				if err := execMigration(ctx, tx, m.opts.Driver, s.File, s.SQL, nil); err != nil {
+					return fmt.Errorf("failed to seed %s: %w", s.Name, err)
+				}
+				if _, err := tx.ExecContext(ctx, m.dialect.rebind("DELETE FROM schema_seeds WHERE name = ? AND env = ?"), s.Name, env); err != nil {
+					return fmt.Errorf("failed to record seed %s: %w", s.Name, err)
+				}
+				_, err := tx.ExecContext(ctx, m.dialect.rebind("INSERT INTO schema_seeds (name, env, checksum, applied_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"),
+					s.Name, env, checksum(s.SQL))
+				if err != nil {
+					return fmt.Errorf("failed to record seed %s: %w", s.Name, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ran++
+		}
+
+		if ran == 0 && !m.opts.DryRun {
+			m.logf("Seeds of %s are up to date", env)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func seedFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"001_admin.sql":          {Data: []byte("INSERT INTO users (id, email) VALUES (1, 'admin') ON CONFLICT DO NOTHING;")},
+		"002_demo.sql":           {Data: []byte("-- migrate:env dev test\nINSERT INTO users (id, email) VALUES (2, 'demo') ON CONFLICT DO NOTHING;")},
+		"sqlite/002_demo.sql":    {Data: []byte("-- migrate:env dev test\nINSERT OR IGNORE INTO users (id, email) VALUES (2, 'sqlite demo');")},
+		"postgres/003_other.sql": {Data: []byte("SELECT 1;")},
+		"README.md":              {Data: []byte("not a seed")},
+	}
+}
+
+func emails(t *testing.T, m *Migrator) []string {
+	t.Helper()
+	rows, err := m.db.Query("SELECT email FROM users ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			t.Fatal(err)
+		}
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	seeds := seedFiles()
+	m := testMigrator(t, db, testFiles(), Options{Seeds: seeds})
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Seed(ctx, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := emails(t, m), []string{"admin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v in prod, want %v", got, want)
+	}
+	if err := m.Seed(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := emails(t, m), []string{"admin", "sqlite demo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v in dev, want %v", got, want)
+	}
+
+	// Unchanged seeds don't run again, changed ones do
+	if _, err := db.Exec("DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	seeds["001_admin.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO users (id, email) VALUES (1, 'root') ON CONFLICT DO NOTHING;")}
+	if err := m.Seed(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := emails(t, m), []string{"root"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v after changing a seed, want %v", got, want)
+	}
+
+	if err := m.Seed(ctx, ""); err == nil {
+		t.Error("got no error without an environment")
+	}
+}
+
+func TestSeedFailureRollsBack(t *testing.T) {
+	ctx := context.Background()
+	seeds := fstest.MapFS{"001_broken.sql": {Data: []byte("INSERT INTO users (id, email) VALUES (1, 'a');\nINSERT INTO missing VALUES (1);")}}
+	m := testMigrator(t, testDB(t), testFiles(), Options{Seeds: seeds})
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Seed(ctx, "dev")
+	if err == nil || !strings.Contains(err.Error(), "001_broken.sql: statement 2 (line 2)") {
+		t.Fatalf("got %v, want an error naming the statement", err)
+	}
+	if got := emails(t, m); len(got) != 0 {
+		t.Errorf("the failed seed left %v behind", got)
+	}
+}
+
+func TestSeedDryRunIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	if err := testMigrator(t, db, testFiles(), Options{}).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &strings.Builder{}
+	m := testMigrator(t, db, testFiles(), Options{Seeds: seedFiles(), DryRun: true, Output: out})
+	if err := m.Seed(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	want := "-- seed: 001_admin (test)\nINSERT INTO users (id, email) VALUES (1, 'admin') ON CONFLICT DO NOTHING;\n\n" +
+		"-- seed: 002_demo (test)\n-- migrate:env dev test\nINSERT OR IGNORE INTO users (id, email) VALUES (2, 'sqlite demo');\n\n"
+	if out.String() != want {
+		t.Errorf("got output\n%s\nwant\n%s", out, want)
+	}
+	for _, table := range tables(t, db) {
+		if table == "schema_seeds" {
+			t.Error("dry run created schema_seeds")
+		}
+	}
+	if got := emails(t, m); len(got) != 0 {
+		t.Errorf("dry run inserted %v", got)
+	}
+}
@@ -0,0 +1,190 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// statement is one statement of a migration file and the line it starts on.
+type statement struct {
+	SQL  string
+	Line int
+}
+
+// splitStatements splits migration SQL on the semicolons that end its
+// statements. Semicolons inside strings, quoted identifiers, comments,
+// Postgres dollar-quoted bodies and the BEGIN ... END body of a trigger don't
+// end a statement. Statements consisting only of comments are dropped.
+func splitStatements(driver, migrationSQL string) ([]statement, error) {
+	s := migrationSQL
+	postgres := driver == "postgres"
+
+	var statements []statement
+	start, startLine, line := 0, 0, 1
+	first, depth, block := "", 0, false
+
+	// significant marks the start of a statement at its first token
+	significant := func() {
+		if startLine == 0 {
+			startLine = line
+		}
+	}
+	flush := func(end int) {
+		if startLine > 0 {
+			statements = append(statements, statement{strings.TrimSpace(s[start:end]), startLine})
+		}
+		start, startLine = end+1, 0
+		first, depth, block = "", 0, false
+	}
+	// skip moves past text that can't end a statement, counting its lines
+	skip := func(from, to int) int {
+		line += strings.Count(s[from:to], "\n")
+		return to
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			i += end
+
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			end, err := blockCommentEnd(s, i, postgres)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			i = skip(i, end)
+
+		case c == '\'' || c == '"' || (!postgres && (c == '`' || c == '[')):
+			significant()
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			// Escape strings have the E right before the quote
+			backslash := postgres && c == '\'' && i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') &&
+				(i == 1 || !isWordByte(s[i-2], postgres))
+			end, err := quotedEnd(s, i, closing, backslash)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			i = skip(i, end)
+
+		case c == '$' && postgres && dollarTag(s[i:]) != "":
+			significant()
+			tag := dollarTag(s[i:])
+			end := strings.Index(s[i+len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated dollar-quoted string %s", line, tag)
+			}
+			i = skip(i, i+len(tag)+end+len(tag))
+
+		case c == ';':
+			i++
+			if depth == 0 {
+				flush(i - 1)
+			}
+
+		case isWordByte(c, false):
+			significant()
+			end := i + 1
+			for end < len(s) && isWordByte(s[end], postgres) {
+				end++
+			}
+			word := strings.ToUpper(s[i:end])
+			if first == "" {
+				first = word
+			}
+
+			// CREATE TRIGGER bodies, and Postgres BEGIN ATOMIC function
+			// bodies, hold statements between BEGIN and END. CASE ... END
+			// can appear inside them too.
+			if first == "CREATE" && (word == "TRIGGER" || word == "FUNCTION" || word == "PROCEDURE") {
+				block = true
+			}
+			if block {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					if depth > 0 {
+						depth--
+					}
+				}
+			}
+			i = end
+
+		case c == '\n':
+			line++
+			i++
+
+		default:
+			if c != ' ' && c != '\t' && c != '\r' {
+				significant()
+			}
+			i++
+		}
+	}
+	flush(len(s))
+	return statements, nil
+}
+
+// quotedEnd returns the index just past the quote closing the string or
+// identifier opened at s[i]. A doubled closing quote is an escaped quote,
+// and so is a backslash escape in Postgres escape strings (E'...').
+func quotedEnd(s string, i int, closing byte, backslash bool) (int, error) {
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case backslash && s[j] == '\\':
+			j++
+		case s[j] == closing && j+1 < len(s) && s[j+1] == closing && closing != ']':
+			j++
+		case s[j] == closing:
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted text %s", s[i:i+1])
+}
+
+// blockCommentEnd returns the index just past the comment opened at s[i].
+// Postgres block comments nest, SQLite ones don't.
+func blockCommentEnd(s string, i int, nested bool) (int, error) {
+	depth := 0
+	for j := i; j+1 < len(s); j++ {
+		switch {
+		case s[j] == '/' && s[j+1] == '*' && (nested || depth == 0):
+			depth++
+			j++
+		case s[j] == '*' && s[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated block comment")
+}
+
+// dollarTag returns the $tag$ opening a Postgres dollar-quoted string at the
+// start of s, or "" when s starts with something else such as $1.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '$':
+			return s[:j+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || (j > 1 && c >= '0' && c <= '9'):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWordByte(c byte, dollar bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80 || (dollar && c == '$')
+}
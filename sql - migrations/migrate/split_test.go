@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		sql    string
+		want   []statement
+	}{
+		{
+			name:   "lines",
+			driver: "sqlite3",
+			sql:    "-- header; not a statement\nCREATE TABLE a (id INTEGER);\n\n/* two\nlines; */ INSERT INTO a VALUES (1);\nINSERT INTO a VALUES (2)",
+			want: []statement{
+				{"-- header; not a statement\nCREATE TABLE a (id INTEGER)", 2},
+				{"/* two\nlines; */ INSERT INTO a VALUES (1)", 5},
+				{"INSERT INTO a VALUES (2)", 6},
+			},
+		},
+		{
+			name:   "quotes",
+			driver: "sqlite3",
+			sql:    `INSERT INTO "a;b" VALUES ('it''s; fine', ` + "`x;y`" + `, [z;w]); SELECT 1;`,
+			want: []statement{
+				{`INSERT INTO "a;b" VALUES ('it''s; fine', ` + "`x;y`" + `, [z;w])`, 1},
+				{"SELECT 1", 1},
+			},
+		},
+		{
+			name:   "trigger",
+			driver: "sqlite3",
+			sql: `CREATE TRIGGER t AFTER INSERT ON a BEGIN
+	UPDATE a SET n = CASE WHEN n > 0 THEN 1 ELSE 0 END;
+	DELETE FROM b;
+END;
+SELECT 1;`,
+			want: []statement{
+				{"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n\tUPDATE a SET n = CASE WHEN n > 0 THEN 1 ELSE 0 END;\n\tDELETE FROM b;\nEND", 1},
+				{"SELECT 1", 5},
+			},
+		},
+		{
+			name:   "comments only",
+			driver: "sqlite3",
+			sql:    "-- Write your UP migration here\n;\n/* nothing */",
+		},
+		{
+			name:   "dollar quotes",
+			driver: "postgres",
+			sql: `CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+	NEW.updated_at = now(); RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+UPDATE a SET b = $1;`,
+			want: []statement{
+				{"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n\tNEW.updated_at = now(); RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql", 1},
+				{"UPDATE a SET b = $1", 6},
+			},
+		},
+		{
+			name:   "escape strings and nested comments",
+			driver: "postgres",
+			sql:    "/* a /* nested; */ comment; */ SELECT E'\\';', 'a\\', e'b\\'', TYPE'c\\'; SELECT 2;",
+			want: []statement{
+				{"/* a /* nested; */ comment; */ SELECT E'\\';', 'a\\', e'b\\'', TYPE'c\\'", 1},
+				{"SELECT 2", 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := splitStatements(test.driver, test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatementsErrors(t *testing.T) {
+	tests := []struct {
+		driver string
+		sql    string
+		want   string
+	}{
+		{"sqlite3", "SELECT 1;\nSELECT 'open;\n", "line 2: unterminated quoted text '"},
+		{"sqlite3", "SELECT 1;\n\n/* open", "line 3: unterminated block comment"},
+		{"postgres", "SELECT 1;\nSELECT $x$ open;", "line 2: unterminated dollar-quoted string $x$"},
+	}
+	for _, test := range tests {
+		_, err := splitStatements(test.driver, test.sql)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got %v, want %q", test.sql, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A baseline's up file starts with this line followed by the IDs of the
+// migrations it replaces, so that databases which applied them can swap
+// their records for the baseline's.
+const squashesMarker = "-- migrate:squashes"
+
+// Squashed describes the baseline files Squash made, as paths in the
+// migrations fs.FS.
+type Squashed struct {
+	// ID of the baseline, that of the last migration it replaces
+	ID int
+	// Files maps each baseline file to its content, with one up and down
+	// pair for the shared files and for each dialect directory overriding
+	// a replaced migration
+	Files map[string]string
+	// Replaced lists the files of the replaced migrations, which should be
+	// deleted once the baseline is written
+	Replaced []string
+}
+
+// parseSquashes returns the IDs listed by the squash marker of an up file.
+func parseSquashes(upSQL string) ([]int, error) {
+	for _, line := range strings.Split(upSQL, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, squashesMarker) {
+			continue
+		}
+		var ids []int
+		for _, field := range strings.Fields(strings.TrimPrefix(line, squashesMarker)) {
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+	return nil, nil
+}
+
+// Squash collapses the migrations from one ID to another, inclusive, into a
+// single baseline that takes the last one's ID. Its up SQL runs theirs in
+// order and its down SQL runs theirs in reverse. Every migration in the range
+// must be applied to this database, so that the files being replaced are
+// known to have worked. Nothing is written: the caller saves the files.
+//
+// Databases that applied the replaced migrations keep working: once the
+// baseline is deployed, their records are replaced by one for the baseline,
+// and databases that applied only part of the range are refused until they
+// are migrated with the old files.
+func (m *Migrator) Squash(ctx context.Context, from, to int, name string) (*Squashed, error) {
+	var squashed *Squashed
+	err := m.run(ctx, func(migrations []Migration) error {
+		applied, err := m.loadApplied(ctx)
+		if err != nil {
+			return err
+		}
+		appliedIDs := map[int]bool{}
+		for _, a := range applied {
+			appliedIDs[a.ID] = true
+		}
+
+		var squash []Migration
+		for _, migration := range migrations {
+			if migration.ID < from || (to != 0 && migration.ID > to) {
+				continue
+			}
+			if migration.Up != nil || migration.Down != nil {
+				return fmt.Errorf("migration %d (%s) is written in Go and can't be squashed", migration.ID, migration.Name)
+			}
+			if !appliedIDs[migration.ID] {
+				return fmt.Errorf("migration %d (%s) is not applied", migration.ID, migration.Name)
+			}
+			squash = append(squash, migration)
+		}
+		if len(squash) < 2 {
+			return fmt.Errorf("at least two migrations are needed to squash")
+		}
+
+		squashed, err = m.squashFiles(squash, name)
+		return err
+	})
+	return squashed, err
+}
+
+// squashFiles concatenates the files of the migrations into a baseline for
+// the shared directory and for every dialect directory that overrides one
+// of them.
+func (m *Migrator) squashFiles(squash []Migration, name string) (*Squashed, error) {
+	last := squash[len(squash)-1]
+	squashed := &Squashed{ID: last.ID, Files: map[string]string{}}
+
+	ids := make([]string, len(squash))
+	for i, migration := range squash {
+		ids[i] = strconv.Itoa(migration.ID)
+	}
+	header := fmt.Sprintf("%s %s\n", squashesMarker, strings.Join(ids, " "))
+
+	var dirs []string
+	for _, d := range dialects {
+		dirs = append(dirs, d.Dir)
+	}
+	sort.Strings(dirs)
+	dirs = append([]string{"."}, dirs...)
+	for _, dir := range dirs {
+		var up, down []string
+		overrides := false
+		for i := range squash {
+			upFile, upSQL, err := m.squashFile(dir, squash[i].UpFile)
+			if err != nil {
+				return nil, err
+			}
+			downFile, downSQL, err := m.squashFile(dir, squash[len(squash)-1-i].DownFile)
+			if err != nil {
+				return nil, err
+			}
+			if upFile != "" {
+				up = append(up, fmt.Sprintf("-- %s\n%s", path.Base(upFile), strings.TrimSpace(upSQL)))
+				overrides = overrides || path.Dir(upFile) == dir
+			}
+			if downFile != "" {
+				down = append(down, fmt.Sprintf("-- %s\n%s", path.Base(downFile), strings.TrimSpace(downSQL)))
+				overrides = overrides || path.Dir(downFile) == dir
+			}
+		}
+		if dir != "." && !overrides {
+			continue
+		}
+		squashed.Files[path.Join(dir, fmt.Sprintf("%d_%s_up.sql", last.ID, name))] = header + "\n" + strings.Join(up, "\n\n") + "\n"
+		squashed.Files[path.Join(dir, fmt.Sprintf("%d_%s_down.sql", last.ID, name))] = strings.Join(down, "\n\n") + "\n"
+	}
+
+	for _, dir := range dirs {
+		for _, migration := range squash {
+			for _, file := range []string{migration.UpFile, migration.DownFile} {
+				replaced := path.Join(dir, path.Base(file))
+				if _, err := fs.Stat(m.fsys, replaced); err == nil {
+					squashed.Replaced = append(squashed.Replaced, replaced)
+				}
+			}
+		}
+	}
+	return squashed, nil
+}
+
+// squashFile reads the file with the same name as file from dir, or else
+// from the shared directory. It returns an empty path when neither has it.
+func (m *Migrator) squashFile(dir, file string) (string, string, error) {
+	if file == "" {
+		return "", "", nil
+	}
+	for _, candidate := range []string{path.Join(dir, path.Base(file)), path.Base(file)} {
+		content, err := fs.ReadFile(m.fsys, candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read file %s: %w", candidate, err)
+		}
+		return candidate, string(content), nil
+	}
+	return "", "", nil
+}
+
+// reconcileSquashed replaces the records of migrations that a baseline
+// squashed with a record of the baseline, as if it had been applied.
+func (m *Migrator) reconcileSquashed(ctx context.Context, migrations []Migration) error {
+	for _, baseline := range migrations {
+		if len(baseline.Squashes) == 0 {
+			continue
+		}
+		applied, err := m.loadApplied(ctx)
+		if err != nil {
+			return err
+		}
+		appliedIDs := map[int]bool{}
+		for _, a := range applied {
+			appliedIDs[a.ID] = true
+		}
+
+		// The baseline shares its ID with the last migration it replaces,
+		// so only the others tell whether this database predates it
+		var found, missing []string
+		for _, id := range baseline.Squashes {
+			if id == baseline.ID {
+				continue
+			}
+			if appliedIDs[id] {
+				found = append(found, strconv.Itoa(id))
+			} else {
+				missing = append(missing, strconv.Itoa(id))
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+		if len(missing) > 0 || !appliedIDs[baseline.ID] {
+			return fmt.Errorf("migration %d (%s) squashes migrations of which only %s are applied; migrate with the files it replaced first",
+				baseline.ID, baseline.Name, strings.Join(found, ", "))
+		}
+		if m.opts.DryRun {
+			m.logf("Would replace the records of migrations %s with squashed migration %d (%s)", strings.Join(found, ", "), baseline.ID, baseline.Name)
+			continue
+		}
+
+		// Keep the baseline's record, which dates when the range was applied
+		tx, err := m.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		for _, id := range baseline.Squashes {
+			if id == baseline.ID {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, m.dialect.rebind("DELETE FROM schema_migrations WHERE id = ?"), id); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to delete migration record %d: %w", id, err)
+			}
+		}
+		_, err = tx.ExecContext(ctx, m.dialect.rebind("UPDATE schema_migrations SET name = ?, up_checksum = ?, down_checksum = ? WHERE id = ?"),
+			baseline.Name, checksum(baseline.UpSQL), checksum(baseline.DownSQL), baseline.ID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record squashed migration %d: %w", baseline.ID, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		m.logf("Replaced the records of migrations %s with squashed migration %d (%s)", strings.Join(found, ", "), baseline.ID, baseline.Name)
+	}
+	return nil
+}
+
+// squashedBy returns the baseline replacing the migration with the given ID.
+func squashedBy(migrations []Migration, id int) *Migration {
+	for i := range migrations {
+		for _, squashed := range migrations[i].Squashes {
+			if squashed == id {
+				return &migrations[i]
+			}
+		}
+	}
+	return nil
+}
+
+// squashesApplied reports whether migration is a baseline and a migration it
+// replaces, other than the one whose ID it took, still has a record.
+func squashesApplied(migration Migration, applied []appliedMigration) bool {
+	for _, id := range migration.Squashes {
+		if id == migration.ID {
+			continue
+		}
+		for _, a := range applied {
+			if a.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
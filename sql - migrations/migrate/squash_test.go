@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	files := testFiles()
+	up, down := files["2_posts_up.sql"], files["2_posts_down.sql"]
+	delete(files, "2_posts_up.sql")
+	delete(files, "2_posts_down.sql")
+	files["3_tags_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (id INTEGER PRIMARY KEY);")}
+
+	for _, policy := range []OutOfOrderPolicy{OutOfOrderError, OutOfOrderWarn, OutOfOrderAllow} {
+		t.Run(string(policy), func(t *testing.T) {
+			db := testDB(t)
+			if err := testMigrator(t, db, files, Options{}).Up(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			// A branch merged after 3 was applied brings migration 2
+			merged := fstest.MapFS{"2_posts_up.sql": up, "2_posts_down.sql": down}
+			for name, file := range files {
+				merged[name] = file
+			}
+			var warnings []string
+			m := testMigrator(t, db, merged, Options{OutOfOrder: policy, Logf: func(format string, args ...interface{}) {
+				if strings.HasPrefix(format, "Warning") {
+					warnings = append(warnings, format)
+				}
+			}})
+
+			err := m.Up(ctx)
+			if policy == OutOfOrderError {
+				if err == nil || !strings.Contains(err.Error(), "older than the last applied migration 3 (tags): 2 (posts)") {
+					t.Fatalf("got %v, want an out-of-order error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+				t.Errorf("got applied %v, want [1 2 3]", got)
+			}
+			if warned := len(warnings) > 0; warned != (policy == OutOfOrderWarn) {
+				t.Errorf("got warnings %q", warnings)
+			}
+		})
+	}
+}
+
+func TestSquash(t *testing.T) {
+	ctx := context.Background()
+	files := testFiles()
+	files["postgres/2_posts_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES users (id));")}
+
+	// partial applied only the first migration of the range
+	db, partial := testDB(t), testDB(t)
+	if err := testMigrator(t, db, files, Options{}).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := testMigrator(t, partial, files, Options{}).UpTo(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testMigrator(t, partial, files, Options{}).Squash(ctx, 1, 2, "baseline"); err == nil || !strings.Contains(err.Error(), "migration 2 (posts) is not applied") {
+		t.Fatalf("got %v, want unapplied migrations to be refused", err)
+	}
+	squashed, err := testMigrator(t, db, files, Options{}).Squash(ctx, 1, 2, "baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if squashed.ID != 2 {
+		t.Errorf("got ID %d, want 2", squashed.ID)
+	}
+	want := map[string]string{
+		"2_baseline_up.sql": "-- migrate:squashes 1 2\n\n" +
+			"-- 1_users_up.sql\nCREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);\n\n" +
+			"-- 2_posts_up.sql\nCREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id));\n",
+		"2_baseline_down.sql": "-- 2_posts_down.sql\nDROP TABLE posts;\n\n-- 1_users_down.sql\nDROP TABLE users;\n",
+		"postgres/2_baseline_up.sql": "-- migrate:squashes 1 2\n\n" +
+			"-- 1_users_up.sql\nCREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);\n\n" +
+			"-- 2_posts_up.sql\nCREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES users (id));\n",
+		"postgres/2_baseline_down.sql": "-- 2_posts_down.sql\nDROP TABLE posts;\n\n-- 1_users_down.sql\nDROP TABLE users;\n",
+	}
+	if !reflect.DeepEqual(squashed.Files, want) {
+		t.Errorf("got files %q, want %q", squashed.Files, want)
+	}
+	wantReplaced := []string{"1_users_up.sql", "1_users_down.sql", "2_posts_up.sql", "2_posts_down.sql", "postgres/2_posts_up.sql"}
+	if !reflect.DeepEqual(squashed.Replaced, wantReplaced) {
+		t.Errorf("got replaced %q, want %q", squashed.Replaced, wantReplaced)
+	}
+
+	baseline := fstest.MapFS{}
+	for name, content := range squashed.Files {
+		baseline[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	// A dry run leaves the records of the range alone, without calling the
+	// baseline modified
+	if err := testMigrator(t, db, baseline, Options{DryRun: true, Output: &strings.Builder{}}).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedIDs(t, testMigrator(t, db, files, Options{})); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("got applied %v after a dry run, want [1 2]", got)
+	}
+
+	// A database that applied the range reports the baseline applied, and
+	// swaps its records for the baseline's on the next run
+	m := testMigrator(t, db, baseline, Options{})
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].ID != 2 || statuses[0].Name != "baseline" || statuses[0].State != Applied {
+		t.Errorf("got statuses %+v, want baseline 2 applied", statuses)
+	}
+	if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("got applied %v after status, want [1 2]", got)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedIDs(t, m); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("got applied %v after up, want [2]", got)
+	}
+
+	// A new database applies the baseline, and one that applied part of
+	// the range is refused
+	fresh := testMigrator(t, testDB(t), baseline, Options{})
+	if err := fresh.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := testMigrator(t, partial, baseline, Options{}).Up(ctx); err == nil || !strings.Contains(err.Error(), "only 1 are applied") {
+		t.Errorf("got %v, want a partially applied range to be refused", err)
+	}
+}
@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// State of a migration in Status.
+type State string
+
+const (
+	Pending State = "pending"
+	Applied State = "applied"
+	// Modified migrations were applied, but their SQL changed since
+	Modified State = "modified"
+	// Missing migrations were applied, but their files no longer exist
+	Missing State = "missing"
+)
+
+// MigrationStatus reports one migration. AppliedAt is zero for pending
+// migrations.
+type MigrationStatus struct {
+	ID        int
+	Name      string
+	State     State
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	ID           int
+	Name         string
+	AppliedAt    sql.NullTime
+	UpChecksum   sql.NullString
+	DownChecksum sql.NullString
+}
+
+func (m *Migrator) loadApplied(ctx context.Context) ([]appliedMigration, error) {
+	if m.untracked {
+		return nil, nil
+	}
+	query := "SELECT id, name, applied_at, up_checksum, down_checksum FROM schema_migrations ORDER BY id"
+	if m.noChecksums {
+		query = "SELECT id, name, applied_at, NULL, NULL FROM schema_migrations ORDER BY id"
+	}
+	rows, err := m.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.ID, &a.Name, &a.AppliedAt, &a.UpChecksum, &a.DownChecksum); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every migration in ID order, followed by the applied
+// migrations whose files are missing. Like a dry run it only reads the
+// database, so it takes no lock.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	r := m.readOnly()
+	migrations, err := r.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.loadApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appliedByID := map[int]appliedMigration{}
+	for _, a := range applied {
+		appliedByID[a.ID] = a
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrations {
+		status := MigrationStatus{ID: migration.ID, Name: migration.Name, State: Pending}
+		if a, ok := appliedByID[migration.ID]; ok {
+			status.State, status.AppliedAt = Applied, a.AppliedAt.Time
+			// A baseline's record is still that of the last migration it
+			// squashes until a run swaps it
+			if len(drift(migration, a)) > 0 && !squashesApplied(migration, applied) {
+				status.State = Modified
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range applied {
+		if findMigration(migrations, a.ID) == nil && squashedBy(migrations, a.ID) == nil {
+			statuses = append(statuses, MigrationStatus{ID: a.ID, Name: a.Name, State: Missing, AppliedAt: a.AppliedAt.Time})
+		}
+	}
+	return statuses, nil
+}
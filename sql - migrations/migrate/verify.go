@@ -0,0 +1,269 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Verify applies every migration to a scratch database, rolls them all back
+// and applies them again. It returns the foreign keys referencing tables or
+// columns that don't exist, the objects down migrations leave behind and the
+// differences between the two applied schemas. On Postgres, where dangling
+// foreign keys already fail the migration itself, the scratch database is a
+// temporary schema of Options.ScratchDB.
+func (m *Migrator) Verify(ctx context.Context) ([]string, error) {
+	scratch, cleanup, err := m.scratchMigrator(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scratch database: %w", err)
+	}
+	defer cleanup()
+	migrations, err := scratch.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	empty, err := schemaObjects(ctx, scratch.conn, m.opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logf("Verifying %d migrations: up", len(migrations))
+	if err := scratch.Up(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := schemaObjects(ctx, scratch.conn, m.opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+	if m.opts.Driver == "sqlite3" {
+		dangling, err := danglingForeignKeys(ctx, scratch.conn)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, dangling...)
+	}
+
+	m.logf("Verifying %d migrations: down", len(migrations))
+	if len(migrations) > 0 {
+		if err := scratch.Rollback(ctx, len(migrations)); err != nil {
+			return nil, err
+		}
+	}
+	reverted, err := schemaObjects(ctx, scratch.conn, m.opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, schemaDiff("after rolling back every migration", empty, reverted)...)
+
+	// Objects left behind by a down migration usually make the next up fail
+	m.logf("Verifying %d migrations: up again", len(migrations))
+	if err := scratch.Up(ctx); err != nil {
+		problems = append(problems, fmt.Sprintf("applying the migrations again failed: %v", err))
+	} else {
+		reapplied, err := schemaObjects(ctx, scratch.conn, m.opts.Driver)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, schemaDiff("after applying the migrations again", applied, reapplied)...)
+	}
+	return problems, nil
+}
+
+// scratchMigrator returns a Migrator for the same migrations on an empty
+// database and the function that disposes of it. SQLite uses an in-memory
+// database; Postgres a temporary schema on one connection of the scratch
+// database, which is refused when it is the target itself.
+func (m *Migrator) scratchMigrator(ctx context.Context) (*Migrator, func(), error) {
+	var c *sql.Conn
+	var cleanup func()
+	if m.opts.Driver == "postgres" {
+		if m.opts.ScratchDB == nil {
+			return nil, nil, fmt.Errorf("postgres needs a separate scratch database")
+		}
+		same, err := sameDatabase(ctx, m.db, m.opts.ScratchDB)
+		if err != nil {
+			return nil, nil, err
+		}
+		if same {
+			return nil, nil, fmt.Errorf("the scratch database is the database being migrated")
+		}
+		c, err = m.opts.ScratchDB.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		schema := fmt.Sprintf("migrate_scratch_%d_%d", os.Getpid(), time.Now().UnixNano())
+		if _, err := c.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+			c.Close()
+			return nil, nil, err
+		}
+		if _, err := c.ExecContext(ctx, "SET search_path TO "+schema); err != nil {
+			c.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE")
+			c.Close()
+			return nil, nil, err
+		}
+		cleanup = func() {
+			// The connection goes back to the pool, so restore its search path
+			if _, err := c.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+				m.logf("Failed to drop scratch schema %s: %v", schema, err)
+			}
+			c.ExecContext(context.Background(), "RESET search_path")
+			c.Close()
+		}
+	} else {
+		// Every connection to :memory: is a separate database, so use one
+		db, err := sql.Open(m.opts.Driver, ":memory:")
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err = db.Conn(ctx)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		cleanup = func() {
+			c.Close()
+			db.Close()
+		}
+	}
+
+	scratch := *m
+	scratch.db, scratch.conn, scratch.scratch = nil, c, true
+	scratch.opts.DryRun = false
+	return &scratch, cleanup, nil
+}
+
+// sameDatabase reports whether two Postgres connection pools reach the same
+// database on the same server address and port.
+func sameDatabase(ctx context.Context, a, b *sql.DB) (bool, error) {
+	const query = "SELECT current_database() || '@' || COALESCE(host(inet_server_addr()), 'local') || ':' || COALESCE(inet_server_port(), 0)"
+	var first, second string
+	if err := a.QueryRowContext(ctx, query).Scan(&first); err != nil {
+		return false, err
+	}
+	if err := b.QueryRowContext(ctx, query).Scan(&second); err != nil {
+		return false, err
+	}
+	return first == second, nil
+}
+
+// schemaObjects returns the definition of every table, index, view, trigger
+// and constraint keyed by kind and name, leaving out migration bookkeeping.
+// On Postgres that includes the functions and procedures of the schema, but
+// not those an extension created.
+func schemaObjects(ctx context.Context, c conn, driver string) (map[string]string, error) {
+	query := "SELECT type || ' ' || name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'"
+	if driver == "postgres" {
+		query = `
+			SELECT 'table ' || table_name, string_agg(column_name || ' ' || data_type ||
+				CASE WHEN is_nullable = 'NO' THEN ' not null' ELSE '' END, ', ' ORDER BY ordinal_position)
+			FROM information_schema.columns WHERE table_schema = current_schema()
+			GROUP BY table_name
+			UNION ALL
+			SELECT 'index ' || indexname, indexdef FROM pg_indexes WHERE schemaname = current_schema()
+			UNION ALL
+			SELECT 'constraint ' || c.conname, pg_get_constraintdef(c.oid)
+			FROM pg_constraint c JOIN pg_namespace n ON n.oid = c.connamespace
+			WHERE n.nspname = current_schema()
+			UNION ALL
+			SELECT 'view ' || viewname, definition FROM pg_views WHERE schemaname = current_schema()
+			UNION ALL
+			SELECT 'trigger ' || t.tgname || ' on ' || c.relname, pg_get_triggerdef(t.oid)
+			FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = current_schema() AND NOT t.tgisinternal
+			UNION ALL
+			SELECT 'function ' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')', pg_get_functiondef(p.oid)
+			FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE n.nspname = current_schema() AND p.prokind IN ('f', 'p')
+				AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
+		`
+	}
+
+	rows, err := c.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	objects := map[string]string{}
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(name, "schema_migrations") && !strings.Contains(name, "schema_seeds") {
+			objects[name] = definition
+		}
+	}
+	return objects, rows.Err()
+}
+
+func schemaDiff(when string, want, got map[string]string) []string {
+	var problems []string
+	for name, definition := range got {
+		if _, ok := want[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s, %s exists but should not", when, name))
+		} else if want[name] != definition {
+			problems = append(problems, fmt.Sprintf("%s, %s is defined differently", when, name))
+		}
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s, %s is missing", when, name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// danglingForeignKeys lists SQLite foreign keys referencing tables or columns
+// that don't exist. SQLite accepts them when the table is created.
+func danglingForeignKeys(ctx context.Context, c conn) ([]string, error) {
+	rows, err := c.QueryContext(ctx, `
+		SELECT t.name, fk."from", fk."table", COALESCE(fk."to", '')
+		FROM sqlite_master t, pragma_foreign_key_list(t.name) fk
+		WHERE t.type = 'table'
+		ORDER BY t.name, fk.id, fk.seq
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	type foreignKey struct{ table, column, refTable, refColumn string }
+	var keys []foreignKey
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.table, &fk.column, &fk.refTable, &fk.refColumn); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, fk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, fk := range keys {
+		var count int
+		err := c.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE ? = '' OR name = ?", fk.refTable, fk.refColumn, fk.refColumn).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		target := fk.refTable
+		if fk.refColumn != "" {
+			target += "(" + fk.refColumn + ")"
+		}
+		problems = append(problems, fmt.Sprintf("foreign key %s.%s references %s, which does not exist", fk.table, fk.column, target))
+	}
+	return problems, nil
+}
@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/lib/pq"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	db := testDB(t)
+	problems, err := testMigrator(t, db, testFiles(), Options{}).Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("got problems %q for valid migrations", problems)
+	}
+	if got := tables(t, db); len(got) != 0 {
+		t.Errorf("verify changed the target database: %v", got)
+	}
+
+	files := testFiles()
+	files["2_posts_up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY, author_id INTEGER REFERENCES authors (id));")}
+	files["2_posts_down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	problems, err = testMigrator(t, testDB(t), files, Options{}).Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"foreign key posts.author_id references authors(id), which does not exist",
+		"after rolling back every migration, table posts exists but should not",
+		"applying the migrations again failed: failed to apply migration 2: failed to apply migration: 2_posts_up.sql: statement 1 (line 1): table posts already exists",
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("got problems\n%q\nwant\n%q", problems, want)
+	}
+}
+
+func TestPostgresScratchDatabaseRequired(t *testing.T) {
+	// Opening doesn't connect, and neither pool is used before the check
+	db, err := sql.Open("postgres", "postgres://localhost/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, testFiles(), Options{Driver: "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Verify(context.Background()); err == nil || !strings.Contains(err.Error(), "separate scratch database") {
+		t.Errorf("got %v, want a scratch database to be required", err)
+	}
+}
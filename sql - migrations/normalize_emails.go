@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerMigration(20250301120000, "normalize_emails", normalizeEmailsUp, normalizeEmailsDown)
+}
+
+// normalizeEmailsUp adds users.email_normalized, the trimmed and lower-cased
+// email used to find accounts on login. It is written in Go because the
+// LOWER of SQLite only folds ASCII letters. The $N placeholders are bound
+// positionally by both drivers.
+func normalizeEmailsUp(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE users ADD COLUMN email_normalized varchar(255)"); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, email FROM users")
+	if err != nil {
+		return err
+	}
+	emails := map[int]string{}
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return err
+		}
+		emails[id] = email
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, email := range emails {
+		normalized := strings.ToLower(strings.TrimSpace(email))
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email_normalized = $1 WHERE id = $2", normalized, id); err != nil {
+			return fmt.Errorf("failed to normalize the email of user %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func normalizeEmailsDown(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "ALTER TABLE users DROP COLUMN email_normalized")
+	return err
+}
@@ -0,0 +1,7 @@
+-- Social login providers, in every environment
+
+insert into login_providers (id, name) values
+  (1, 'google'),
+  (2, 'github'),
+  (3, 'apple')
+on conflict do nothing;
@@ -0,0 +1,25 @@
+-- migrate:env dev test
+-- A demo project with its languages and notification types
+
+insert into projects (id, name) values (1, 'Demo')
+on conflict do nothing;
+
+insert into languages (id, project_id, name) values
+  (1, 1, 'English'),
+  (2, 1, 'Spanish'),
+  (3, 1, 'Portuguese')
+on conflict do nothing;
+
+insert into content_types (id, project_id, default_language_id, name, kind) values
+  (1, 1, 1, 'Notification', 'text')
+on conflict do nothing;
+
+insert into contents (id, content_type_id, name) values
+  (1, 1, 'Welcome'),
+  (2, 1, 'Password reset')
+on conflict do nothing;
+
+insert into notification_types (id, project_id, content_id, name) values
+  (1, 1, 1, 'welcome'),
+  (2, 1, 2, 'password_reset')
+on conflict do nothing;
@@ -0,0 +1,10 @@
+-- Social login providers, in every environment
+
+insert into login_providers (id, name) values
+  (1, 'google'),
+  (2, 'github'),
+  (3, 'apple')
+on conflict do nothing;
+
+-- Explicit IDs leave the sequence behind
+select setval(pg_get_serial_sequence('login_providers', 'id'), (select max(id) from login_providers));
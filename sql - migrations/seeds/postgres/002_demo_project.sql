@@ -0,0 +1,32 @@
+-- migrate:env dev test
+-- A demo project with its languages and notification types
+
+insert into projects (id, name) values (1, 'Demo')
+on conflict do nothing;
+
+insert into languages (id, project_id, name) values
+  (1, 1, 'English'),
+  (2, 1, 'Spanish'),
+  (3, 1, 'Portuguese')
+on conflict do nothing;
+
+insert into content_types (id, project_id, default_language_id, name, kind) values
+  (1, 1, 1, 'Notification', 'text')
+on conflict do nothing;
+
+insert into contents (id, content_type_id, name) values
+  (1, 1, 'Welcome'),
+  (2, 1, 'Password reset')
+on conflict do nothing;
+
+insert into notification_types (id, project_id, content_id, name) values
+  (1, 1, 1, 'welcome'),
+  (2, 1, 2, 'password_reset')
+on conflict do nothing;
+
+-- Explicit IDs leave the sequences behind
+select setval(pg_get_serial_sequence('projects', 'id'), (select max(id) from projects));
+select setval(pg_get_serial_sequence('languages', 'id'), (select max(id) from languages));
+select setval(pg_get_serial_sequence('content_types', 'id'), (select max(id) from content_types));
+select setval(pg_get_serial_sequence('contents', 'id'), (select max(id) from contents));
+select setval(pg_get_serial_sequence('notification_types', 'id'), (select max(id) from notification_types));
@@ -2,6 +2,10 @@ module github.com/shff/squirrel_test
 
 go 1.23.4
 
-require github.com/vektah/gqlparser/v2 v2.5.21
+require (
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.24
+	github.com/vektah/gqlparser/v2 v2.5.21
+)
 
 require github.com/agnivade/levenshtein v1.2.0 // indirect
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type dbColumn struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+}
+
+type dbForeignKey struct {
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+type dbTable struct {
+	Name        string
+	Columns     []dbColumn
+	ForeignKeys []dbForeignKey
+}
+
+// key returns the primary key column, or "" for composite or missing keys.
+func (t *dbTable) key() string {
+	key := ""
+	for _, c := range t.Columns {
+		if c.PrimaryKey {
+			if key != "" {
+				return ""
+			}
+			key = c.Name
+		}
+	}
+	return key
+}
+
+// introspect reads tables, columns and foreign keys from a live database.
+func introspect(ctx context.Context, db *sql.DB, driver string) ([]*dbTable, error) {
+	switch driver {
+	case "sqlite3":
+		return introspectSQLite(ctx, db)
+	case "postgres":
+		return introspectPostgres(ctx, db)
+	default:
+		return nil, fmt.Errorf("unsupported driver %s", driver)
+	}
+}
+
+func introspectSQLite(ctx context.Context, db *sql.DB) ([]*dbTable, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []*dbTable
+	for rows.Next() {
+		t := &dbTable{}
+		if err := rows.Scan(&t.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tables {
+		columns, err := db.QueryContext(ctx, "SELECT name, type, \"notnull\", pk FROM pragma_table_info(?) ORDER BY cid", t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %w", t.Name, err)
+		}
+		for columns.Next() {
+			var c dbColumn
+			var pk int
+			if err := columns.Scan(&c.Name, &c.Type, &c.NotNull, &pk); err != nil {
+				columns.Close()
+				return nil, err
+			}
+			c.PrimaryKey = pk > 0
+			t.Columns = append(t.Columns, c)
+		}
+		columns.Close()
+
+		keys, err := db.QueryContext(ctx, "SELECT \"from\", \"table\", COALESCE(\"to\", '') FROM pragma_foreign_key_list(?) ORDER BY id, seq", t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of %s: %w", t.Name, err)
+		}
+		for keys.Next() {
+			var fk dbForeignKey
+			if err := keys.Scan(&fk.Column, &fk.RefTable, &fk.RefColumn); err != nil {
+				keys.Close()
+				return nil, err
+			}
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+		keys.Close()
+	}
+	return tables, nil
+}
+
+func introspectPostgres(ctx context.Context, db *sql.DB) ([]*dbTable, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.table_name, c.column_name, c.data_type, c.is_nullable = 'NO',
+			EXISTS (
+				SELECT 1 FROM information_schema.table_constraints tc
+				JOIN information_schema.key_column_usage k
+					ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema
+				WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+					AND tc.table_name = c.table_name AND k.column_name = c.column_name
+			)
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+			ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = current_schema() AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []*dbTable
+	byName := map[string]*dbTable{}
+	for rows.Next() {
+		var name string
+		var c dbColumn
+		if err := rows.Scan(&name, &c.Name, &c.Type, &c.NotNull, &c.PrimaryKey); err != nil {
+			return nil, err
+		}
+		t := byName[name]
+		if t == nil {
+			t = &dbTable{Name: name}
+			byName[name] = t
+			tables = append(tables, t)
+		}
+		t.Columns = append(t.Columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys, err := db.QueryContext(ctx, `
+		SELECT k.table_name, k.column_name, u.table_name, u.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage k
+			ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema
+		JOIN information_schema.constraint_column_usage u
+			ON u.constraint_name = tc.constraint_name AND u.constraint_schema = tc.table_schema
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()
+		ORDER BY k.table_name, k.ordinal_position
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	defer keys.Close()
+
+	for keys.Next() {
+		var name string
+		var fk dbForeignKey
+		if err := keys.Scan(&name, &fk.Column, &fk.RefTable, &fk.RefColumn); err != nil {
+			return nil, err
+		}
+		if t := byName[name]; t != nil {
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+	}
+	return tables, keys.Err()
+}
+
+// introspectedTypes writes one object type per table with a single column
+// primary key. Every foreign key becomes a many-to-one field on the owning
+// table and a one-to-many list on the referenced one. Tables and foreign
+// keys that can't be mapped are reported as warnings.
+func introspectedTypes(tables []*dbTable) (string, []string) {
+	byName := map[string]*dbTable{}
+	for _, t := range tables {
+		if t.key() != "" {
+			byName[t.Name] = t
+		}
+	}
+
+	type field struct {
+		name string
+		sdl  string
+	}
+	fields := map[string][]field{}
+	used := map[string]map[string]bool{}
+	for _, t := range tables {
+		used[t.Name] = map[string]bool{}
+		for _, c := range t.Columns {
+			used[t.Name][c.Name] = true
+		}
+	}
+	unique := func(table, name, fallback string) string {
+		if used[table][name] {
+			name = fallback
+		}
+		used[table][name] = true
+		return name
+	}
+
+	var warnings []string
+	for _, t := range tables {
+		if byName[t.Name] == nil {
+			warnings = append(warnings, fmt.Sprintf("skipped table %s: no single column primary key", t.Name))
+			continue
+		}
+
+		targets := map[string]int{}
+		for _, fk := range t.ForeignKeys {
+			targets[fk.RefTable]++
+		}
+
+		for _, fk := range t.ForeignKeys {
+			ref := byName[fk.RefTable]
+			if ref == nil {
+				warnings = append(warnings, fmt.Sprintf("skipped foreign key %s.%s: table %s does not exist", t.Name, fk.Column, fk.RefTable))
+				continue
+			}
+			if fk.RefColumn == "" {
+				fk.RefColumn = ref.key()
+			}
+			directive := fmt.Sprintf("@relation(column: %q, references: %q)", fk.Column, fk.RefColumn)
+
+			name := unique(t.Name, strings.TrimSuffix(fk.Column, "_id"), fk.Column+"_"+typeName(ref.Name))
+			fields[t.Name] = append(fields[t.Name], field{name, fmt.Sprintf("%s: %s %s", name, typeName(ref.Name), directive)})
+
+			list := t.Name
+			if targets[fk.RefTable] > 1 {
+				list = t.Name + "_by_" + fk.Column
+			}
+			list = unique(ref.Name, list, t.Name+"_by_"+fk.Column)
+			fields[ref.Name] = append(fields[ref.Name], field{list, fmt.Sprintf("%s: [%s!] %s", list, typeName(t.Name), directive)})
+		}
+	}
+
+	sdl := &bytes.Buffer{}
+	for _, t := range tables {
+		if byName[t.Name] == nil {
+			continue
+		}
+
+		fmt.Fprintf(sdl, "type %s @table(name: %q, key: %q) {\n", typeName(t.Name), t.Name, t.key())
+		for _, c := range t.Columns {
+			fmt.Fprintf(sdl, "\t%s: %s\n", c.Name, graphQLType(c))
+		}
+		relations := fields[t.Name]
+		sort.SliceStable(relations, func(i, j int) bool { return relations[i].name < relations[j].name })
+		for _, f := range relations {
+			fmt.Fprintf(sdl, "\t%s\n", f.sdl)
+		}
+		sdl.WriteString("}\n")
+	}
+	return sdl.String(), warnings
+}
+
+// typeName turns a table name into a singular type name:
+// users => User, resource_type => ResourceType, policies => Policy.
+func typeName(table string) string {
+	switch {
+	case strings.HasSuffix(table, "ies"):
+		table = strings.TrimSuffix(table, "ies") + "y"
+	case strings.HasSuffix(table, "sses"), strings.HasSuffix(table, "xes"),
+		strings.HasSuffix(table, "ches"), strings.HasSuffix(table, "shes"):
+		table = strings.TrimSuffix(table, "es")
+	case strings.HasSuffix(table, "s") && !strings.HasSuffix(table, "ss"):
+		table = strings.TrimSuffix(table, "s")
+	}
+
+	var name strings.Builder
+	for _, word := range strings.Split(table, "_") {
+		if word != "" {
+			name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return name.String()
+}
+
+func graphQLType(c dbColumn) string {
+	t := strings.ToLower(c.Type)
+	name := "String"
+	switch {
+	case c.PrimaryKey:
+		name = "ID"
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		name = "Int"
+	case strings.Contains(t, "real") || strings.Contains(t, "floa") || strings.Contains(t, "doub") ||
+		strings.Contains(t, "numeric") || strings.Contains(t, "decimal"):
+		name = "Float"
+	case strings.Contains(t, "bool"):
+		name = "Boolean"
+	}
+	if c.NotNull || c.PrimaryKey {
+		name += "!"
+	}
+	return name
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestIntrospectSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE companies (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TABLE users (id INTEGER PRIMARY KEY, company_id INTEGER REFERENCES companies, score REAL, active BOOLEAN NOT NULL);
+		CREATE TABLE transfers (
+			id INTEGER PRIMARY KEY,
+			from_id INTEGER NOT NULL REFERENCES users (id),
+			to_id INTEGER NOT NULL REFERENCES users (id),
+			ghost_id INTEGER REFERENCES ghosts (id)
+		);
+		CREATE TABLE memberships (user_id INTEGER, company_id INTEGER, PRIMARY KEY (user_id, company_id));
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := introspect(context.Background(), db, "sqlite3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdl, warnings := introspectedTypes(tables)
+
+	want := `type Company @table(name: "companies", key: "id") {
+	id: ID!
+	name: String!
+	users: [User!] @relation(column: "company_id", references: "id")
+}
+type Transfer @table(name: "transfers", key: "id") {
+	id: ID!
+	from_id: Int!
+	to_id: Int!
+	ghost_id: Int
+	from: User @relation(column: "from_id", references: "id")
+	to: User @relation(column: "to_id", references: "id")
+}
+type User @table(name: "users", key: "id") {
+	id: ID!
+	company_id: Int
+	score: Float
+	active: Boolean!
+	company: Company @relation(column: "company_id", references: "id")
+	transfers_by_from_id: [Transfer!] @relation(column: "from_id", references: "id")
+	transfers_by_to_id: [Transfer!] @relation(column: "to_id", references: "id")
+}
+`
+	if sdl != want {
+		t.Errorf("got\n%s\nwant\n%s", sdl, want)
+	}
+
+	wantWarnings := []string{
+		"skipped table memberships: no single column primary key",
+		"skipped foreign key transfers.ghost_id: table ghosts does not exist",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", warnings, wantWarnings)
+	}
+
+	if _, err := buildSchema(sdl); err != nil {
+		t.Errorf("introspected types do not build a schema: %v", err)
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	for table, want := range map[string]string{
+		"users":         "User",
+		"policies":      "Policy",
+		"addresses":     "Address",
+		"boxes":         "Box",
+		"resource_type": "ResourceType",
+		"access":        "Access",
+	} {
+		if got := typeName(table); got != want {
+			t.Errorf("typeName(%q) = %q, want %q", table, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// limits bound how much SQL a single operation can turn into. Depth counts
+// nested object fields, Fields counts every selected field after fragments
+// are expanded, and Cost estimates the rows read: each object field costs
+// its Costs entry (1 by default) plus its children's cost times the number
+// of rows it can return. That is limit or first when given and ListSize for
+// other lists. Zero disables a limit.
+type limits struct {
+	MaxDepth  int
+	MaxFields int
+	MaxCost   int
+	ListSize  int
+	Costs     map[string]int
+}
+
+var defaultLimits = limits{
+	MaxDepth:  8,
+	MaxFields: 200,
+	MaxCost:   10000,
+	ListSize:  100,
+}
+
+type analysis struct {
+	limits
+	vars   map[string]interface{}
+	fields int
+	errs   gqlerror.List
+}
+
+// check analyzes op and returns GraphQL errors for every limit it exceeds.
+func (l limits) check(op *ast.OperationDefinition, vars map[string]interface{}) gqlerror.List {
+	a := &analysis{limits: l, vars: vars}
+	cost := a.cost(op.SelectionSet, 1)
+
+	if l.MaxFields > 0 && a.fields > l.MaxFields {
+		a.errorf(op.Position, "MAX_FIELDS_EXCEEDED", a.fields, l.MaxFields,
+			"operation selects %d fields, more than the maximum of %d", a.fields, l.MaxFields)
+	}
+	if l.MaxCost > 0 && cost > l.MaxCost {
+		a.errorf(op.Position, "MAX_COST_EXCEEDED", cost, l.MaxCost,
+			"operation has an estimated cost of %d, more than the maximum of %d", cost, l.MaxCost)
+	}
+	return a.errs
+}
+
+func (a *analysis) cost(set ast.SelectionSet, depth int) int {
+	cost := 0
+	for _, field := range collectFields(set) {
+		a.fields++
+		if len(field.SelectionSet) == 0 {
+			continue
+		}
+
+		if a.MaxDepth > 0 && depth > a.MaxDepth {
+			a.errorf(field.Position, "MAX_DEPTH_EXCEEDED", depth, a.MaxDepth,
+				"field %s is nested %d levels deep, more than the maximum of %d", field.Alias, depth, a.MaxDepth)
+			continue
+		}
+
+		fieldCost := 1
+		if field.ObjectDefinition != nil {
+			if c, ok := a.Costs[field.ObjectDefinition.Name+"."+field.Name]; ok && c >= 0 {
+				fieldCost = c
+			}
+		}
+		cost = addCost(cost, addCost(fieldCost, mulCost(a.rows(field), a.cost(field.SelectionSet, depth+1))))
+	}
+	return cost
+}
+
+// Helpers: costs saturate at math.MaxInt instead of wrapping around, which
+// nested limits would otherwise make negative
+func addCost(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+func mulCost(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// rows estimates how many objects a field returns. The edges of a
+// connection don't multiply again: the connection field already did.
+func (a *analysis) rows(field *ast.Field) int {
+	for _, name := range []string{"limit", "first"} {
+		if arg := field.Arguments.ForName(name); arg != nil {
+			value, err := literal(arg.Value, a.vars)
+			if err == nil && value != nil {
+				if n, err := asInt(value); err == nil {
+					return n
+				}
+			}
+		}
+	}
+
+	switch {
+	case field.Definition == nil, field.Name == "edges":
+		return 1
+	case field.Definition.Type.Elem != nil, strings.HasSuffix(field.Definition.Type.Name(), "Connection"):
+		return a.ListSize
+	default:
+		return 1
+	}
+}
+
+func (a *analysis) errorf(pos *ast.Position, code string, value, limit int, message string, args ...interface{}) {
+	err := gqlerror.ErrorPosf(pos, message, args...)
+	if err.Extensions == nil {
+		err.Extensions = map[string]interface{}{}
+	}
+	err.Extensions["code"] = code
+	err.Extensions["value"] = value
+	err.Extensions["limit"] = limit
+	a.errs = append(a.errs, err)
+}
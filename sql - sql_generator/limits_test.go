@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	gqlparser "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// A tree of nodes that can be nested as deep as a query likes
+const treeSchema = `
+	type Query { nodes(limit: Int): [Node!]! }
+	type Node {
+		id: ID!
+		name: String!
+		children(limit: Int): [Node!]!
+		parent: Node
+	}
+`
+
+func TestLimits(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Name: "tree", Input: treeSchema})
+	l := limits{MaxDepth: 3, MaxFields: 10, MaxCost: 1000, ListSize: 10, Costs: map[string]int{"Node.parent": 5}}
+
+	tests := []struct {
+		name  string
+		query string
+		vars  map[string]interface{}
+		code  string
+		value interface{}
+	}{
+		{name: "within limits", query: `{ nodes(limit: 5) { id children { id } } }`},
+		{
+			// 1 + 10 * (1 + 10 * 1)
+			name:  "list size",
+			query: `{ nodes { children { children { id } } } }`,
+		},
+		{
+			// Scalars cost nothing
+			name:  "cost",
+			query: `{ nodes(limit: 50) { children(limit: 50) { children { id } } } }`,
+			code:  "MAX_COST_EXCEEDED", value: 1 + 50*(1+50*1),
+		},
+		{
+			name:  "custom field cost",
+			query: `{ nodes(limit: 300) { parent { id } } }`,
+			code:  "MAX_COST_EXCEEDED", value: 1 + 300*5,
+		},
+		{
+			name:  "limit from a variable",
+			query: `query($n: Int) { nodes(limit: $n) { children(limit: $n) { children { id } } } }`,
+			vars:  map[string]interface{}{"n": 1000.0},
+			code:  "MAX_COST_EXCEEDED",
+		},
+		{
+			name:  "depth",
+			query: `{ nodes(limit: 1) { children(limit: 1) { children(limit: 1) { children(limit: 1) { id } } } } }`,
+			code:  "MAX_DEPTH_EXCEEDED", value: 4,
+		},
+		{
+			name:  "fields after fragments",
+			query: `{ nodes(limit: 1) { ...f children(limit: 1) { ...f } } } fragment f on Node { id name parent { id name } }`,
+			code:  "MAX_FIELDS_EXCEEDED", value: 12,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := l.check(operation(t, schema, test.query), test.vars)
+			if test.code == "" {
+				if len(errs) > 0 {
+					t.Fatal(errs)
+				}
+				return
+			}
+			if len(errs) != 1 {
+				t.Fatalf("got errors %v, want one %s", errs, test.code)
+			}
+			if code := errs[0].Extensions["code"]; code != test.code {
+				t.Errorf("got code %v, want %s", code, test.code)
+			}
+			if test.value != nil && errs[0].Extensions["value"] != test.value {
+				t.Errorf("got value %v, want %v", errs[0].Extensions["value"], test.value)
+			}
+		})
+	}
+}
+
+func TestLimitsCostSaturates(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Name: "tree", Input: treeSchema})
+	l := limits{MaxDepth: 8, MaxCost: 10000, ListSize: 100}
+
+	// Each level multiplies by 2^31-1: without saturation the total wraps
+	// around and can come out small or negative
+	query := `{ nodes(limit: 2147483647) {
+		children(limit: 2147483647) { children(limit: 2147483647) {
+			children(limit: 2147483647) { children(limit: 2147483647) { id } }
+		} }
+	} }`
+	errs := l.check(operation(t, schema, query), nil)
+	if len(errs) != 1 || errs[0].Extensions["code"] != "MAX_COST_EXCEEDED" {
+		t.Fatalf("got errors %v, want MAX_COST_EXCEEDED", errs)
+	}
+	if value := errs[0].Extensions["value"]; value != math.MaxInt {
+		t.Errorf("got cost %v, want it to saturate at %d", value, math.MaxInt)
+	}
+
+	// Variables skip validation of Int's 32 bits
+	query = `query($n: Int) { nodes(limit: $n) { children(limit: $n) { children { id } } } }`
+	errs = l.check(operation(t, schema, query), map[string]interface{}{"n": 9e18})
+	if len(errs) != 1 || errs[0].Extensions["value"] != math.MaxInt {
+		t.Errorf("got errors %v, want a saturated MAX_COST_EXCEEDED", errs)
+	}
+}
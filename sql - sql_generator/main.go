@@ -2,12 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"io"
+	"log"
 	"strings"
 
 	gqlparser "github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 type PlaceholderFormat interface {
@@ -80,6 +87,81 @@ func (p part) ToSql() (sql string, args []interface{}, err error) {
 	return
 }
 
+type conj []Sqlizer
+
+func (c conj) join(sep, defaultExpr string) (sql string, args []interface{}, err error) {
+	if len(c) == 0 {
+		return defaultExpr, []interface{}{}, nil
+	}
+	var sqlParts []string
+	for _, sqlizer := range c {
+		partSql, partArgs, err := nestedToSql(sqlizer)
+		if err != nil {
+			return "", nil, err
+		}
+		if partSql != "" {
+			sqlParts = append(sqlParts, partSql)
+			args = append(args, partArgs...)
+		}
+	}
+	if len(sqlParts) > 0 {
+		sql = fmt.Sprintf("(%s)", strings.Join(sqlParts, sep))
+	}
+	return
+}
+
+type And conj
+
+func (a And) ToSql() (string, []interface{}, error) {
+	return conj(a).join(" AND ", "(1=1)")
+}
+
+type Or conj
+
+func (o Or) ToSql() (string, []interface{}, error) {
+	return conj(o).join(" OR ", "(1=0)")
+}
+
+type Not struct {
+	Pred Sqlizer
+}
+
+func (n Not) ToSql() (sql string, args []interface{}, err error) {
+	sql, args, err = nestedToSql(n.Pred)
+	if err != nil {
+		return
+	}
+	sql = fmt.Sprintf("NOT (%s)", sql)
+	return
+}
+
+type Exists struct {
+	Query Sqlizer
+}
+
+func (e Exists) ToSql() (sql string, args []interface{}, err error) {
+	sql, args, err = nestedToSql(e.Query)
+	if err != nil {
+		return
+	}
+	sql = fmt.Sprintf("EXISTS (%s)", sql)
+	return
+}
+
+type aliasPart struct {
+	pred  Sqlizer
+	alias string
+}
+
+func (a aliasPart) ToSql() (sql string, args []interface{}, err error) {
+	sql, args, err = nestedToSql(a.pred)
+	if err != nil {
+		return
+	}
+	sql = fmt.Sprintf("(%s) AS %s", sql, a.alias)
+	return
+}
+
 type selectData struct {
 	PlaceholderFormat PlaceholderFormat
 	Options           []string
@@ -219,6 +301,33 @@ func (d *selectData) toSqlRaw() (sqlStr string, args []interface{}, err error) {
 }
 
 func main() {
+	driver := flag.String("driver", "sqlite3", "Database driver for -dsn: sqlite3 or postgres")
+	dsn := flag.String("dsn", "", "Print the GraphQL schema of this database instead of running the demo")
+	flag.Parse()
+
+	if *dsn != "" {
+		db, err := sql.Open(*driver, *dsn)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+
+		tables, err := introspect(context.Background(), db, *driver)
+		if err != nil {
+			log.Fatalf("Failed to introspect database: %v", err)
+		}
+		types, warnings := introspectedTypes(tables)
+		for _, warning := range warnings {
+			log.Println(warning)
+		}
+		sdl, err := generateSchema(types)
+		if err != nil {
+			log.Fatalf("Failed to generate schema: %v", err)
+		}
+		fmt.Print(sdl)
+		return
+	}
+
 	schema := `
 		type User {
 			id: ID!
@@ -226,32 +335,52 @@ func main() {
 			age: Int!
 			orders: [Order!]
 		}
-		type Order {
+		type Order @table(columns: ["user_id"]) {
 			id: ID!
 			total: Float!
 		}
-		type Query {
-			users(age: Int, name: String): [User!]!
-		}
 	`
 
 	query := `
-		query {
-			users(age: 30, name: "John") {
+		query Users {
+			users(where: {age: {_gt: 30}, _or: [{name: {_eq: "John"}}, {orders: {total: {_gt: 100}}}]}, order_by: [{name: asc}], limit: 10) {
 				id
 				name
-				orders {
+				orders(order_by: {total: desc}) {
 					id
 					total
 				}
 			}
+			users_connection(first: 2, after: "WyJKb2huIiwxXQ==", order_by: {name: asc}) {
+				edges {
+					cursor
+					node {
+						id
+						name
+					}
+				}
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
+			}
+		}
+
+		mutation AdjustUsers {
+			update_users(where: {name: {_eq: "John"}}, _set: {age: 31}) {
+				affected_rows
+				returning {
+					id
+					age
+				}
+			}
+			delete_users(where: {age: {_lt: 18}}) {
+				affected_rows
+			}
 		}
 	`
 
-	parsedSchema, err := gqlparser.LoadSchema(&ast.Source{
-		Name:  "Schema",
-		Input: schema,
-	})
+	parsedSchema, err := buildSchema(schema)
 	if err != nil {
 		fmt.Println("Error parsing schema:", err)
 		return
@@ -263,37 +392,42 @@ func main() {
 		return
 	}
 
-	for _, op := range parsedQuery.Operations {
-		for _, sel := range op.SelectionSet {
-			if field, ok := sel.(*ast.Field); ok {
-
-				table := field.Name
+	// Every user and order read or written is restricted to the session's user
+	ctx := withSession(context.Background(), session{"user_id": 1})
+	policies := map[string]Policy{
+		"users":  columnPolicy("id", "user_id"),
+		"orders": columnPolicy("user_id", "user_id"),
+	}
 
-				columns := []Sqlizer{}
-				for _, sel := range field.SelectionSet {
-					if field, ok := sel.(*ast.Field); ok {
-						columns = append(columns, newPart(field.Name))
-					}
-				}
+	for _, op := range parsedQuery.Operations {
+		if errs := defaultLimits.check(op, nil); len(errs) > 0 {
+			fmt.Println("Query rejected:", errs)
+			continue
+		}
 
-				where := []Sqlizer{}
-				for _, arg := range field.Arguments {
-					where = append(where, newPart(fmt.Sprintf("%s = ?", arg.Name), arg.Value))
+		for _, field := range collectFields(op.SelectionSet) {
+			var statements []Sqlizer
+			if op.Operation == ast.Mutation {
+				m, err := newTranslator(ctx, parsedSchema, nil, policies).mutation(field)
+				if err != nil {
+					panic(err)
 				}
-
-				dt := &selectData{
-					PlaceholderFormat: dollarFormat{},
-					Columns:           columns,
-					From:              newPart(table),
-					WhereParts:        where,
+				statements = m.Statements
+			} else {
+				q, err := newTranslator(ctx, parsedSchema, nil, policies).query(field)
+				if err != nil {
+					panic(err)
 				}
+				statements = []Sqlizer{q.Select}
+			}
 
-				sql, args, err := dt.ToSql()
+			for _, statement := range statements {
+				sql, args, err := statement.ToSql()
 				if err != nil {
 					panic(err)
 				}
 				fmt.Println(sql)
-				fmt.Print(args)
+				fmt.Println(args)
 			}
 		}
 	}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// fieldMutation is a mutation root field compiled to INSERT, UPDATE or
+// DELETE statements. Their RETURNING rows feed the returning selection; when
+// it asks for relations the affected rows are read back by key instead.
+// Check counts how many written rows still satisfy the table's policy.
+// Visible selects the keys of the affected rows the select policy lets the
+// request read, which are the only ones returned; a delete runs it before
+// the rows are gone.
+type fieldMutation struct {
+	Selection  ast.SelectionSet
+	Statements []Sqlizer
+	Returning  *node
+	Refetch    *fieldQuery
+	Check      *selectData
+	Visible    *fieldQuery
+	Delete     bool
+}
+
+func (t *translator) mutation(field *ast.Field) (*fieldMutation, error) {
+	def := t.schema.Types[field.Definition.Type.Name()]
+	returningDef := def.Fields.ForName("returning")
+	if returningDef == nil {
+		return nil, fmt.Errorf("%s is not a generated mutation", field.Name)
+	}
+	target := t.schema.Types[returningDef.Type.Name()]
+	tbl := tableFor(target)
+
+	var selection ast.SelectionSet
+	for _, f := range collectFields(field.SelectionSet) {
+		if f.Name == "returning" {
+			selection = append(selection, f.SelectionSet...)
+		}
+	}
+
+	m := &fieldMutation{
+		Selection: field.SelectionSet,
+		Returning: &node{Def: target, Table: tbl, List: true},
+	}
+	returning := []string{tbl.Key}
+	relations := false
+	for _, f := range collectFields(selection) {
+		if f.Name == "__typename" {
+			m.Returning.Fields = append(m.Returning.Fields, column{Key: f.Alias, Index: -1, Const: target.Name})
+			continue
+		}
+		if _, ok := relationFor(t.schema, target, f.Definition); ok {
+			relations = true
+			continue
+		}
+		index := indexOf(returning, f.Name)
+		if index < 0 {
+			returning = append(returning, f.Name)
+			index = len(returning) - 1
+		}
+		m.Returning.Fields = append(m.Returning.Fields, column{Key: f.Alias, Index: index})
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(field.Name, "insert_"):
+		m.Statements, err = t.insert(target, tbl, field, returning)
+	case strings.HasPrefix(field.Name, "update_"):
+		m.Statements, err = t.update(target, tbl, field, returning)
+	case strings.HasPrefix(field.Name, "delete_"):
+		if relations {
+			return nil, fmt.Errorf("relations cannot be selected from rows deleted by %s", field.Name)
+		}
+		m.Delete = true
+		m.Statements, m.Visible, err = t.delete(target, tbl, field, returning)
+	default:
+		return nil, fmt.Errorf("unknown mutation %s", field.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if relations {
+		m.Refetch, err = newTranslator(t.ctx, t.schema, t.vars, t.reads).objects(target, selection)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !m.Delete {
+		m.Visible, err = t.visible(target, t.alias(), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !strings.HasPrefix(field.Name, "delete_") {
+		alias := t.alias()
+		policy, err := t.policy(target, alias)
+		if err != nil {
+			return nil, err
+		}
+		if len(policy) > 0 {
+			m.Check = &selectData{
+				PlaceholderFormat: dollarFormat{},
+				Columns:           []Sqlizer{newPart("COUNT(*)")},
+				From:              newPart(fmt.Sprintf("%s AS %s", tbl.Name, alias)),
+				WhereParts:        policy,
+			}
+		}
+	}
+	return m, nil
+}
+
+// insert batches consecutive objects that set the same columns into one
+// multi-row INSERT. Objects setting no columns use DEFAULT VALUES.
+func (t *translator) insert(def *ast.Definition, tbl table, field *ast.Field, returning []string) ([]Sqlizer, error) {
+	value, err := literal(field.Arguments.ForName("objects").Value, t.vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []Sqlizer
+	var current *insertData
+	for _, item := range asList(value) {
+		columns, values, err := t.columnValues(def, item)
+		if err != nil {
+			return nil, err
+		}
+
+		if current != nil && len(columns) > 0 && strings.Join(current.Columns, ",") == strings.Join(columns, ",") {
+			current.Values = append(current.Values, values)
+			continue
+		}
+		current = &insertData{
+			PlaceholderFormat: dollarFormat{},
+			Into:              tbl.Name,
+			Columns:           columns,
+			Values:            [][]interface{}{values},
+			Returning:         returning,
+		}
+		statements = append(statements, current)
+	}
+	return statements, nil
+}
+
+func (t *translator) update(def *ast.Definition, tbl table, field *ast.Field, returning []string) ([]Sqlizer, error) {
+	alias := t.alias()
+	where, err := t.mutationWhere(def, alias, field)
+	if err != nil {
+		return nil, err
+	}
+
+	set := field.Arguments.ForName("_set")
+	if set == nil {
+		return nil, fmt.Errorf("%s requires _set", field.Name)
+	}
+	value, err := literal(set.Value, t.vars)
+	if err != nil {
+		return nil, err
+	}
+	columns, values, err := t.columnValues(def, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s requires at least one column in _set", field.Name)
+	}
+
+	d := &updateData{
+		PlaceholderFormat: dollarFormat{},
+		Table:             fmt.Sprintf("%s AS %s", tbl.Name, alias),
+		WhereParts:        where,
+		Returning:         returning,
+	}
+	for i, column := range columns {
+		d.SetClauses = append(d.SetClauses, setClause{column, values[i]})
+	}
+	return []Sqlizer{d}, nil
+}
+
+// delete also returns the query for the keys of the rows it deletes that
+// the request can read, if that is restricted.
+func (t *translator) delete(def *ast.Definition, tbl table, field *ast.Field, returning []string) ([]Sqlizer, *fieldQuery, error) {
+	alias := t.alias()
+	where, err := t.mutationWhere(def, alias, field)
+	if err != nil {
+		return nil, nil, err
+	}
+	visible, err := t.visible(def, alias, where)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []Sqlizer{&deleteData{
+		PlaceholderFormat: dollarFormat{},
+		From:              fmt.Sprintf("%s AS %s", tbl.Name, alias),
+		WhereParts:        where,
+		Returning:         returning,
+	}}, visible, nil
+}
+
+// visible selects the keys of def's rows matching where that the select
+// policy lets the request read. It is nil when reads are unrestricted.
+func (t *translator) visible(def *ast.Definition, alias string, where []Sqlizer) (*fieldQuery, error) {
+	if t.reads == nil {
+		return nil, nil
+	}
+	policy, err := t.readPolicy(def, alias)
+	if err != nil {
+		return nil, err
+	}
+	root := &node{Def: def, Table: tableFor(def), Alias: alias}
+	return &fieldQuery{Select: &selectData{
+		PlaceholderFormat: dollarFormat{},
+		Columns:           []Sqlizer{newPart(alias + "." + root.Table.Key)},
+		From:              newPart(fmt.Sprintf("%s AS %s", root.Table.Name, alias)),
+		WhereParts:        append(append([]Sqlizer{}, where...), policy...),
+	}, Root: root}, nil
+}
+
+// mutationWhere requires a where argument so that an update or delete
+// never touches the whole table by accident; {} still matches every row the
+// table's policy allows.
+func (t *translator) mutationWhere(def *ast.Definition, alias string, field *ast.Field) ([]Sqlizer, error) {
+	arg := field.Arguments.ForName("where")
+	if arg == nil {
+		return nil, fmt.Errorf("%s requires a where argument", field.Name)
+	}
+	value, err := literal(arg.Value, t.vars)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := t.boolExp(def, alias, value)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := t.policy(def, alias)
+	if err != nil {
+		return nil, err
+	}
+	return append(policy, exp), nil
+}
+
+func (t *translator) columnValues(def *ast.Definition, value interface{}) ([]string, []interface{}, error) {
+	fields, err := asObject(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columns []string
+	var values []interface{}
+	for _, f := range fields {
+		fieldDef := def.Fields.ForName(f.Name)
+		if fieldDef == nil {
+			return nil, nil, fmt.Errorf("unknown field %s on %s", f.Name, def.Name)
+		}
+		if _, ok := relationFor(t.schema, def, fieldDef); ok {
+			return nil, nil, fmt.Errorf("nested writes to %s are not supported", f.Name)
+		}
+		columns = append(columns, f.Name)
+		values = append(values, f.Value)
+	}
+	return columns, values, nil
+}
+
+func (m *fieldMutation) execute(ctx context.Context, db queryer) (interface{}, error) {
+	visible := newCollector()
+	if m.Visible != nil && m.Delete {
+		if _, err := collect(ctx, db, m.Visible.Select, m.Visible.Root, visible); err != nil {
+			return nil, err
+		}
+	}
+
+	returned := newCollector()
+	affected := 0
+	for _, statement := range m.Statements {
+		n, err := collect(ctx, db, statement, m.Returning, returned)
+		if err != nil {
+			return nil, err
+		}
+		affected += n
+	}
+
+	if m.Check != nil && len(returned.keys) > 0 {
+		if err := m.check(ctx, db, returned.keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Visible != nil && !m.Delete && len(returned.keys) > 0 {
+		query := *m.Visible.Select
+		query.WhereParts = append(query.WhereParts, keyIn(m.Visible.Root, returned.keys))
+		if _, err := collect(ctx, db, &query, m.Visible.Root, visible); err != nil {
+			return nil, err
+		}
+	}
+	if m.Visible != nil {
+		returned.keep(visible.items)
+	}
+
+	var returning interface{}
+	if m.Refetch == nil {
+		returning = m.Returning.value(returned)
+	} else if len(returned.keys) == 0 {
+		returning = []interface{}{}
+	} else {
+		root := m.Refetch.Root
+		m.Refetch.Select.WhereParts = append(m.Refetch.Select.WhereParts, keyIn(root, returned.keys))
+		var err error
+		returning, err = m.Refetch.execute(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := map[string]interface{}{}
+	for _, f := range collectFields(m.Selection) {
+		switch f.Name {
+		case "__typename":
+			result[f.Alias] = f.ObjectDefinition.Name
+		case "affected_rows":
+			result[f.Alias] = affected
+		case "returning":
+			result[f.Alias] = returning
+		}
+	}
+	return result, nil
+}
+
+// check fails the mutation, and with it the transaction, when a written row
+// falls outside the table's policy, e.g. an insert into another project.
+func (m *fieldMutation) check(ctx context.Context, db queryer, keys []interface{}) error {
+	check := *m.Check
+	check.WhereParts = append(check.WhereParts, keyIn(m.Returning, keys))
+	query, args, err := check.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if count != len(keys) {
+		return fmt.Errorf("%d of %d rows written to %s violate its policy", len(keys)-count, len(keys), m.Returning.Table.Name)
+	}
+	return nil
+}
+
+func keyIn(n *node, keys []interface{}) Sqlizer {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+	column := n.Table.Key
+	if n.Alias != "" {
+		column = n.Alias + "." + column
+	}
+	return newPart(fmt.Sprintf("%s IN (%s)", column, placeholders), keys...)
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
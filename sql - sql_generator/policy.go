@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// session holds the request values policies can refer to as $session.<key>,
+// e.g. the authenticated user_id and project_id.
+type session map[string]interface{}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, s session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+func sessionFrom(ctx context.Context) session {
+	s, _ := ctx.Value(sessionKey{}).(session)
+	return s
+}
+
+// Policy returns the filter every row of a table must match for the request
+// in ctx, in the same form as a where argument. The translator ANDs it into
+// each place the table is read: root fields, joined relations, relation
+// filters and the rows touched by mutations.
+type Policy func(ctx context.Context) (interface{}, error)
+
+// columnPolicy restricts a table to rows whose column equals a session
+// value: columnPolicy("project_id", "project_id") => project_id = $session.project_id.
+func columnPolicy(column, key string) Policy {
+	return func(ctx context.Context) (interface{}, error) {
+		value, ok := sessionFrom(ctx)[key]
+		if !ok {
+			return nil, fmt.Errorf("session has no %s", key)
+		}
+		return []objectField{{column, []objectField{{"_eq", value}}}}, nil
+	}
+}
+
+// conditionPolicy parses a JSON boolean expression, such as the condition
+// column of the policies table. String values of the form "$session.<key>"
+// are replaced with the session value when the policy is evaluated.
+func conditionPolicy(condition []byte) (Policy, error) {
+	var value interface{}
+	if err := json.Unmarshal(condition, &value); err != nil {
+		return nil, fmt.Errorf("invalid policy condition: %w", err)
+	}
+	value = ordered(value)
+
+	return func(ctx context.Context) (interface{}, error) {
+		return withSessionValues(value, sessionFrom(ctx))
+	}, nil
+}
+
+// anyPolicy grants access when at least one of policies matches. With no
+// policies it denies every row.
+func anyPolicy(policies ...Policy) Policy {
+	return func(ctx context.Context) (interface{}, error) {
+		conditions := []interface{}{}
+		for _, policy := range policies {
+			condition, err := policy(ctx)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		return []objectField{{"_or", conditions}}, nil
+	}
+}
+
+func withSessionValues(value interface{}, s session) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if !strings.HasPrefix(value, "$session.") {
+			return value, nil
+		}
+		key := strings.TrimPrefix(value, "$session.")
+		v, ok := s[key]
+		if !ok {
+			return nil, fmt.Errorf("session has no %s", key)
+		}
+		return v, nil
+	case []objectField:
+		fields := make([]objectField, len(value))
+		for i, f := range value {
+			v, err := withSessionValues(f.Value, s)
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = objectField{f.Name, v}
+		}
+		return fields, nil
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			v, err := withSessionValues(item, s)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+const policiesQuery = `
+		SELECT rt.name, sc.name, p.condition
+		FROM resource_type rt
+		LEFT JOIN actions a ON a.resource_type_id = rt.id AND a.name = ? AND a.deleted_at IS NULL
+		LEFT JOIN policies p ON p.action_id = a.id AND p.deleted_at IS NULL AND p.permission_id IN (
+			SELECT up.permission_id FROM user_permissions up
+			WHERE up.user_id = ? AND up.deleted_at IS NULL
+			UNION
+			SELECT rp.permission_id FROM role_permissions rp
+			JOIN user_roles ur ON ur.role_id = rp.role_id AND ur.deleted_at IS NULL
+			WHERE ur.user_id = ? AND rp.deleted_at IS NULL
+		)
+		LEFT JOIN scopes sc ON sc.id = p.scope_id
+		WHERE rt.project_id = ? AND rt.deleted_at IS NULL
+		ORDER BY rt.name, p.id
+	`
+
+// loadPolicies builds the policies of a session's user for one action from
+// the policies table. Each resource type of the session's project names a
+// table; its policies are those granted to the user directly or through a
+// role. Tables without any granted policy, or that aren't a resource type of
+// the project, can't be used at all. Policies tied to a scope only apply
+// when the session carries that scope.
+func loadPolicies(ctx context.Context, db *sql.DB, driver, action string, s session) (map[string]Policy, error) {
+	for _, key := range []string{"user_id", "project_id"} {
+		if _, ok := s[key]; !ok {
+			return nil, fmt.Errorf("session has no %s", key)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, rebind(driver, policiesQuery), action, s["user_id"], s["user_id"], s["project_id"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := map[string]bool{}
+	if list, ok := s["scopes"].([]string); ok {
+		for _, scope := range list {
+			scopes[scope] = true
+		}
+	}
+
+	granted := map[string][]Policy{}
+	for rows.Next() {
+		var table string
+		var scope sql.NullString
+		var condition []byte
+		if err := rows.Scan(&table, &scope, &condition); err != nil {
+			return nil, err
+		}
+		if _, ok := granted[table]; !ok {
+			granted[table] = []Policy{}
+		}
+		if condition == nil || (scope.Valid && !scopes[scope.String]) {
+			continue
+		}
+		policy, err := conditionPolicy(condition)
+		if err != nil {
+			return nil, fmt.Errorf("policy on %s: %w", table, err)
+		}
+		granted[table] = append(granted[table], policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	policies := map[string]Policy{}
+	for table, list := range granted {
+		policies[table] = anyPolicy(list...)
+	}
+	return policies, nil
+}
+
+// rebind replaces the ? placeholders of query with those of driver.
+func rebind(driver, query string) string {
+	if driver == "postgres" {
+		query, _ = dollarFormat{}.ReplacePlaceholders(query)
+	}
+	return query
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const policyTables = `
+	CREATE TABLE resource_type (id INTEGER PRIMARY KEY, project_id INTEGER, name TEXT, deleted_at TIMESTAMP);
+	CREATE TABLE actions (id INTEGER PRIMARY KEY, resource_type_id INTEGER, name TEXT, deleted_at TIMESTAMP);
+	CREATE TABLE scopes (id INTEGER PRIMARY KEY, resource_type_id INTEGER, name TEXT, deleted_at TIMESTAMP);
+	CREATE TABLE policies (id INTEGER PRIMARY KEY, permission_id INTEGER, action_id INTEGER, scope_id INTEGER, condition BLOB, deleted_at TIMESTAMP);
+	CREATE TABLE user_permissions (id INTEGER PRIMARY KEY, permission_id INTEGER, user_id INTEGER, deleted_at TIMESTAMP);
+	CREATE TABLE role_permissions (id INTEGER PRIMARY KEY, role_id INTEGER, permission_id INTEGER, deleted_at TIMESTAMP);
+	CREATE TABLE user_roles (id INTEGER PRIMARY KEY, role_id INTEGER, user_id INTEGER, deleted_at TIMESTAMP);
+
+	-- Orders can be selected and deleted, users only updated
+	INSERT INTO resource_type VALUES (1, 1, 'orders', NULL), (2, 1, 'users', NULL);
+	INSERT INTO actions VALUES (1, 1, 'select', NULL), (2, 1, 'delete', NULL), (3, 2, 'update', NULL);
+	INSERT INTO scopes VALUES (1, 1, 'all', NULL);
+
+	-- User 1 reads their own orders through role 100, and every order with
+	-- the all scope through a direct grant
+	INSERT INTO user_roles VALUES (1, 100, 1, NULL);
+	INSERT INTO role_permissions VALUES (1, 100, 10, NULL);
+	INSERT INTO user_permissions VALUES (1, 11, 1, NULL);
+	INSERT INTO policies VALUES
+		(1, 10, 1, NULL, '{"user_id": {"_eq": "$session.user_id"}}', NULL),
+		(2, 11, 1, 1, '{}', NULL),
+		(3, 10, 2, NULL, '{"user_id": {"_eq": "$session.user_id"}, "total": {"_lt": 15}}', NULL),
+		(4, 10, 1, NULL, '{"total": {"_gt": 0}}', '2024-01-01');
+
+	INSERT INTO users (id, name) VALUES (1, 'a'), (2, 'b');
+	INSERT INTO orders (id, user_id, total) VALUES (1, 1, 10), (2, 1, 20), (3, 2, 30);
+`
+
+func TestLoadedPolicies(t *testing.T) {
+	db := testDB(t, policyTables)
+	schema := testSchema(t)
+	opts := options{Policies: func(ctx context.Context, action string) (map[string]Policy, error) {
+		return loadPolicies(ctx, db, "sqlite3", action, sessionFrom(ctx))
+	}}
+
+	run := func(s session, query string) (map[string]interface{}, error) {
+		t.Helper()
+		return resolve(withSession(context.Background(), s), db, schema, operation(t, schema, query), nil, opts)
+	}
+	totals := func(s session, query string) []float64 {
+		t.Helper()
+		data, err := run(s, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list := []float64{}
+		for _, order := range data["orders"].([]interface{}) {
+			list = append(list, order.(map[string]interface{})["total"].(float64))
+		}
+		return list
+	}
+
+	user1 := session{"user_id": 1, "project_id": 1}
+	user2 := session{"user_id": 2, "project_id": 1}
+	admin := session{"user_id": 1, "project_id": 1, "scopes": []string{"read", "all"}}
+	query := `{ orders(order_by: {id: asc}) { total } }`
+
+	if got, want := totals(user1, query), []float64{10, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("user 1 read orders %v, want %v", got, want)
+	}
+	if got, want := totals(admin, query), []float64{10, 20, 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("user 1 with the all scope read orders %v, want %v", got, want)
+	}
+	if got := totals(user2, query); len(got) != 0 {
+		t.Errorf("user 2 without grants read orders %v", got)
+	}
+
+	// Users is a resource type without a select action
+	data, err := run(admin, `{ users { name } }`)
+	if err != nil || len(data["users"].([]interface{})) != 0 {
+		t.Errorf("read users: got %v, %v, want none", data, err)
+	}
+
+	// Delete has a policy of its own
+	data, err = run(admin, `mutation { delete_orders(where: {}) { affected_rows } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data["delete_orders"].(map[string]interface{})["affected_rows"]; got != 1 {
+		t.Errorf("deleted %v orders, want 1", got)
+	}
+
+	if _, err := run(session{"user_id": 1}, query); err == nil || !strings.Contains(err.Error(), "session has no project_id") {
+		t.Errorf("got %v without a project, want an error", err)
+	}
+}
+
+func TestPoliciesDenyUnlistedTables(t *testing.T) {
+	db := testDB(t, `INSERT INTO users (id, name) VALUES (1, 'a'); INSERT INTO orders (id, user_id, total) VALUES (1, 1, 10)`)
+	schema := testSchema(t)
+	opts := options{Policies: staticPolicies(map[string]Policy{"users": conditionPolicyOf(t, `{}`)})}
+	run := func(query string) (map[string]interface{}, error) {
+		t.Helper()
+		return resolve(context.Background(), db, schema, operation(t, schema, query), nil, opts)
+	}
+
+	data, err := run(`{ users { name orders { total } } orders { total } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"users":  []interface{}{map[string]interface{}{"name": "a", "orders": []interface{}{}}},
+		"orders": []interface{}{},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %#v, want %#v", data, want)
+	}
+
+	if _, err := run(`mutation { insert_orders(objects: [{id: 2, user_id: 1, total: 20}]) { affected_rows } }`); err == nil || !strings.Contains(err.Error(), "violate its policy") {
+		t.Errorf("got %v, want an insert into orders to be refused", err)
+	}
+	data, err = run(`mutation { delete_orders(where: {}) { affected_rows } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data["delete_orders"].(map[string]interface{})["affected_rows"]; got != 0 {
+		t.Errorf("deleted %v orders, want none", got)
+	}
+}
+
+func TestPolicyColumns(t *testing.T) {
+	schema, err := buildSchema(`
+		type Note @table(columns: ["owner_id"]) {
+			id: ID!
+			body: String
+			author: User
+		}
+		type User {
+			id: ID!
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := collectFields(operation(t, schema, `{ notes { body } }`).SelectionSet)[0]
+	ctx := withSession(context.Background(), session{"user_id": 1})
+
+	tests := []struct {
+		condition string
+		sql       string
+		err       string
+	}{
+		{condition: `{"owner_id": {"_eq": "$session.user_id"}}`, sql: "SELECT t0.id, t0.body FROM notes AS t0 WHERE ((t0.owner_id = $1))"},
+		{condition: `{"author_id": {"_eq": "$session.user_id"}}`, sql: "SELECT t0.id, t0.body FROM notes AS t0 WHERE ((t0.author_id = $1))"},
+		{condition: `{"project_id": {"_eq": 1}}`, err: "unknown field project_id on Note"},
+		{condition: `{"1=1 OR owner_id": {"_eq": 1}}`, err: "unknown field 1=1 OR owner_id on Note"},
+	}
+	for _, test := range tests {
+		policies := map[string]Policy{"notes": conditionPolicyOf(t, test.condition), "users": conditionPolicyOf(t, `{}`)}
+		q, err := newTranslator(ctx, schema, nil, policies).query(field)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got %v, want %q", test.condition, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, _, err := q.Select.ToSql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != test.sql {
+			t.Errorf("%s: got SQL\n%s\nwant\n%s", test.condition, sql, test.sql)
+		}
+	}
+}
+
+func TestMutationsReturnOnlyReadableRows(t *testing.T) {
+	db := testDB(t, `INSERT INTO users (id, name) VALUES (1, 'a'), (2, 'b'); INSERT INTO orders (id, user_id, total) VALUES (1, 1, 10), (2, 2, 20)`)
+	schema := testSchema(t)
+	ctx := withSession(context.Background(), session{"user_id": 1})
+	// Orders can be written for anyone, but only read for the session's user
+	opts := options{Policies: func(ctx context.Context, action string) (map[string]Policy, error) {
+		orders := conditionPolicyOf(t, `{}`)
+		if action == "select" {
+			orders = columnPolicy("user_id", "user_id")
+		}
+		return map[string]Policy{"users": conditionPolicyOf(t, `{}`), "orders": orders}, nil
+	}}
+
+	tests := []struct {
+		name     string
+		mutation string
+		affected int
+		want     interface{}
+	}{
+		{"insert", `insert_orders(objects: [{id: 3, user_id: 1, total: 30}, {id: 4, user_id: 2, total: 40}])`, 2,
+			[]interface{}{map[string]interface{}{"total": 30.0}}},
+		{"update", `update_orders(where: {total: {_gt: 25}}, _set: {total: 50})`, 2,
+			[]interface{}{map[string]interface{}{"total": 50.0}}},
+		{"delete", `delete_orders(where: {total: {_eq: 50}})`, 2,
+			[]interface{}{map[string]interface{}{"total": 50.0}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := resolve(ctx, db, schema, operation(t, schema, `mutation { m: `+test.mutation+` { affected_rows returning { total } } }`), nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := data["m"].(map[string]interface{})
+			if result["affected_rows"] != test.affected || !reflect.DeepEqual(result["returning"], test.want) {
+				t.Errorf("got %v, want %d affected and returning %v", result, test.affected, test.want)
+			}
+		})
+	}
+
+	// Relations read back after a write only show readable rows
+	data, err := resolve(ctx, db, schema, operation(t, schema, `mutation {
+		update_users(where: {id: {_eq: 2}}, _set: {nickname: "n"}) { returning { name orders { total } } }
+	}`), nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{map[string]interface{}{"name": "b", "orders": []interface{}{}}}
+	if got := data["update_users"].(map[string]interface{})["returning"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func conditionPolicyOf(t *testing.T, condition string) Policy {
+	t.Helper()
+	policy, err := conditionPolicy([]byte(condition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestRebind(t *testing.T) {
+	query := rebind("postgres", policiesQuery)
+	if strings.Contains(query, "?") {
+		t.Errorf("postgres query still has ? placeholders:\n%s", query)
+	}
+	for _, placeholder := range []string{"$1", "$2", "$3", "$4"} {
+		if !strings.Contains(query, placeholder) {
+			t.Errorf("postgres query has no %s:\n%s", placeholder, query)
+		}
+	}
+	if rebind("sqlite3", policiesQuery) != policiesQuery {
+		t.Error("sqlite3 query was rebound")
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type executable interface {
+	execute(ctx context.Context, db queryer) (interface{}, error)
+}
+
+// options configure how operations are checked and translated. Policies
+// returns the policies, keyed by table name, of one action of the request
+// in ctx: select for queries and for the rows mutations return, and insert,
+// update or delete for mutation fields. A table missing from the policies of
+// an action can't be used for it. Without Policies every table is
+// unrestricted.
+type options struct {
+	Policies func(ctx context.Context, action string) (map[string]Policy, error)
+	Limits   limits
+}
+
+// staticPolicies applies the same policies to every action.
+func staticPolicies(policies map[string]Policy) func(context.Context, string) (map[string]Policy, error) {
+	return func(context.Context, string) (map[string]Policy, error) {
+		return policies, nil
+	}
+}
+
+// resolve runs every root field of an operation and returns the response
+// data keyed by field alias. All fields of a mutation share one transaction.
+// Operations over the configured limits fail with a gqlerror.List before
+// any SQL is built.
+func resolve(ctx context.Context, db *sql.DB, schema *ast.Schema, op *ast.OperationDefinition, vars map[string]interface{}, opts options) (map[string]interface{}, error) {
+	if errs := opts.Limits.check(op, vars); len(errs) > 0 {
+		return nil, errs
+	}
+	// Loaded before a mutation's transaction begins, so that they are never
+	// read on a second connection while the transaction holds one
+	policies, err := actionPolicies(ctx, op, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Operation {
+	case ast.Query:
+		return resolveFields(ctx, db, schema, op, vars, policies)
+	case ast.Mutation:
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		data, err := resolveFields(ctx, tx, schema, op, vars, policies)
+		if err != nil {
+			return nil, err
+		}
+		return data, tx.Commit()
+	default:
+		return nil, fmt.Errorf("unsupported operation %s", op.Operation)
+	}
+}
+
+// actionPolicies loads the policies of every action op performs, and those
+// of select for what a mutation returns.
+func actionPolicies(ctx context.Context, op *ast.OperationDefinition, opts options) (map[string]map[string]Policy, error) {
+	policies := map[string]map[string]Policy{}
+	if opts.Policies == nil {
+		return policies, nil
+	}
+	for _, field := range collectFields(op.SelectionSet) {
+		if field.Name == "__typename" {
+			continue
+		}
+		actions := []string{fieldAction(op, field)}
+		if op.Operation == ast.Mutation {
+			actions = append(actions, "select")
+		}
+		for _, action := range actions {
+			if _, ok := policies[action]; ok {
+				continue
+			}
+			p, err := opts.Policies(ctx, action)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Alias, err)
+			}
+			if p == nil {
+				p = map[string]Policy{}
+			}
+			policies[action] = p
+		}
+	}
+	return policies, nil
+}
+
+func fieldAction(op *ast.OperationDefinition, field *ast.Field) string {
+	if op.Operation != ast.Mutation {
+		return "select"
+	}
+	action, _, _ := strings.Cut(field.Name, "_")
+	return action
+}
+
+func resolveFields(ctx context.Context, db queryer, schema *ast.Schema, op *ast.OperationDefinition, vars map[string]interface{}, policies map[string]map[string]Policy) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for _, field := range collectFields(op.SelectionSet) {
+		if field.Name == "__typename" {
+			data[field.Alias] = field.ObjectDefinition.Name
+			continue
+		}
+
+		var run executable
+		var err error
+		t := newTranslator(ctx, schema, vars, policies[fieldAction(op, field)])
+		if op.Operation == ast.Mutation {
+			t.reads = policies["select"]
+			run, err = t.mutation(field)
+		} else {
+			run, err = t.query(field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Alias, err)
+		}
+
+		result, err := run.execute(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Alias, err)
+		}
+		data[field.Alias] = result
+	}
+	return data, nil
+}
+
+func (q *fieldQuery) execute(ctx context.Context, db queryer) (interface{}, error) {
+	root := newCollector()
+	if _, err := collect(ctx, db, q.Select, q.Root, root); err != nil {
+		return nil, err
+	}
+	return q.Root.value(root), nil
+}
+
+// collect runs statement and adds its rows to c, returning the row count.
+func collect(ctx context.Context, db queryer, statement Sqlizer, n *node, c *collector) (int, error) {
+	query, args, err := statement.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		for i, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+		c.add(n, row)
+		count++
+	}
+	return count, rows.Err()
+}
+
+// collector groups joined rows by key, keeping the order rows arrived in.
+type collector struct {
+	keys  []interface{}
+	items map[interface{}]*item
+}
+
+type item struct {
+	row      []interface{}
+	children []*collector
+}
+
+func newCollector() *collector {
+	return &collector{items: map[interface{}]*item{}}
+}
+
+// keep drops the items whose keys aren't in keys.
+func (c *collector) keep(keys map[interface{}]*item) {
+	kept := []interface{}{}
+	for _, key := range c.keys {
+		if keys[key] != nil {
+			kept = append(kept, key)
+		} else {
+			delete(c.items, key)
+		}
+	}
+	c.keys = kept
+}
+
+func (c *collector) add(n *node, row []interface{}) {
+	key := row[n.KeyIndex]
+	if key == nil {
+		return
+	}
+
+	it, ok := c.items[key]
+	if !ok {
+		it = &item{row: row, children: make([]*collector, len(n.Children))}
+		for i := range n.Children {
+			it.children[i] = newCollector()
+		}
+		c.items[key] = it
+		c.keys = append(c.keys, key)
+	}
+
+	for i, child := range n.Children {
+		it.children[i].add(child, row)
+	}
+}
+
+func (n *node) value(c *collector) interface{} {
+	if n.Connection != nil {
+		return n.connection(c)
+	}
+
+	objects := []interface{}{}
+	for _, key := range c.keys {
+		objects = append(objects, n.object(c.items[key]))
+	}
+	if n.List {
+		return objects
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	return objects[0]
+}
+
+func (n *node) object(it *item) map[string]interface{} {
+	obj := map[string]interface{}{}
+	for _, f := range n.Fields {
+		if f.Index < 0 {
+			obj[f.Key] = f.Const
+		} else {
+			obj[f.Key] = it.row[f.Index]
+		}
+	}
+	for i, child := range n.Children {
+		obj[child.Key] = child.value(it.children[i])
+	}
+	return obj
+}
+
+// connection shapes the collected nodes into edges and pageInfo. One extra
+// row is fetched beyond first to tell whether there is a next page.
+func (n *node) connection(c *collector) map[string]interface{} {
+	keys := c.keys
+	first := n.Connection.First
+	hasNextPage := first != nil && len(keys) > *first
+	if hasNextPage {
+		keys = keys[:*first]
+	}
+
+	cursors := make([]string, len(keys))
+	for i, key := range keys {
+		row := c.items[key].row
+		values := make([]interface{}, len(n.Connection.Cursor))
+		for j, index := range n.Connection.Cursor {
+			values[j] = row[index]
+		}
+		cursors[i] = encodeCursor(values)
+	}
+
+	result := map[string]interface{}{}
+	for _, field := range collectFields(n.Connection.Selection) {
+		switch field.Name {
+		case "__typename":
+			result[field.Alias] = field.ObjectDefinition.Name
+		case "edges":
+			edges := []interface{}{}
+			for i, key := range keys {
+				edge := map[string]interface{}{}
+				for _, f := range collectFields(field.SelectionSet) {
+					switch f.Name {
+					case "__typename":
+						edge[f.Alias] = f.ObjectDefinition.Name
+					case "cursor":
+						edge[f.Alias] = cursors[i]
+					case "node":
+						edge[f.Alias] = n.object(c.items[key])
+					}
+				}
+				edges = append(edges, edge)
+			}
+			result[field.Alias] = edges
+		case "pageInfo":
+			pageInfo := map[string]interface{}{}
+			for _, f := range collectFields(field.SelectionSet) {
+				switch f.Name {
+				case "__typename":
+					pageInfo[f.Alias] = f.ObjectDefinition.Name
+				case "hasNextPage":
+					pageInfo[f.Alias] = hasNextPage
+				case "hasPreviousPage":
+					pageInfo[f.Alias] = n.Connection.After
+				case "startCursor", "endCursor":
+					pageInfo[f.Alias] = nil
+					if len(cursors) > 0 && f.Name == "startCursor" {
+						pageInfo[f.Alias] = cursors[0]
+					} else if len(cursors) > 0 {
+						pageInfo[f.Alias] = cursors[len(cursors)-1]
+					}
+				}
+			}
+			result[field.Alias] = pageInfo
+		}
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, db *sql.DB, query string, opts options) (map[string]interface{}, error) {
+	t.Helper()
+	schema := testSchema(t)
+	return resolve(context.Background(), db, schema, operation(t, schema, query), nil, opts)
+}
+
+func count(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestInsertReturning(t *testing.T) {
+	db := testDB(t)
+	data, err := run(t, db, `mutation {
+		insert_users(objects: [{id: 1, name: "a", age: 30}, {id: 2, name: "b", age: 40}]) {
+			affected_rows
+			returning { id name }
+		}
+	}`, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"insert_users": map[string]interface{}{
+			"affected_rows": 2,
+			"returning": []interface{}{
+				map[string]interface{}{"id": int64(1), "name": "a"},
+				map[string]interface{}{"id": int64(2), "name": "b"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %#v, want %#v", data, want)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM users"); n != 2 {
+		t.Errorf("got %d users, want 2", n)
+	}
+}
+
+func TestInsertRefetchesRelations(t *testing.T) {
+	db := testDB(t, `INSERT INTO orders (id, user_id, total) VALUES (1, 7, 10), (2, 7, 20)`)
+	data, err := run(t, db, `mutation {
+		insert_users(objects: [{id: 7, name: "a"}]) {
+			returning { name orders(order_by: {total: desc}) { total } }
+		}
+	}`, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	returning := data["insert_users"].(map[string]interface{})["returning"]
+	want := []interface{}{map[string]interface{}{
+		"name": "a",
+		"orders": []interface{}{
+			map[string]interface{}{"total": 20.0},
+			map[string]interface{}{"total": 10.0},
+		},
+	}}
+	if !reflect.DeepEqual(returning, want) {
+		t.Errorf("got %#v, want %#v", returning, want)
+	}
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	db := testDB(t, `INSERT INTO users (id, name, age) VALUES (1, 'a', 20), (2, 'b', 40), (3, 'c', 60)`)
+	data, err := run(t, db, `mutation {
+		update_users(where: {age: {_gt: 30}}, _set: {nickname: "old"}) {
+			affected_rows
+			returning { id nickname }
+		}
+		delete_users(where: {age: {_lt: 30}}) {
+			affected_rows
+			returning { name }
+		}
+	}`, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"update_users": map[string]interface{}{
+			"affected_rows": 2,
+			"returning": []interface{}{
+				map[string]interface{}{"id": int64(2), "nickname": "old"},
+				map[string]interface{}{"id": int64(3), "nickname": "old"},
+			},
+		},
+		"delete_users": map[string]interface{}{
+			"affected_rows": 1,
+			"returning":     []interface{}{map[string]interface{}{"name": "a"}},
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %#v, want %#v", data, want)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM users WHERE nickname = 'old'"); n != 2 {
+		t.Errorf("got %d updated users, want 2", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM users"); n != 2 {
+		t.Errorf("got %d users, want 2", n)
+	}
+}
+
+func TestMutationRollsBackOnPolicyViolation(t *testing.T) {
+	db := testDB(t, `INSERT INTO orders (id, user_id, total) VALUES (1, 1, 10), (2, 2, 20)`)
+	opts := options{Policies: staticPolicies(map[string]Policy{"orders": columnPolicy("user_id", "user_id")})}
+	ctx := withSession(context.Background(), session{"user_id": 1})
+	schema := testSchema(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		// The first field is valid, but shares the transaction of the second
+		{"insert for another user", `mutation {
+			a: insert_orders(objects: [{id: 3, user_id: 1, total: 30}]) { affected_rows }
+			b: insert_orders(objects: [{id: 4, user_id: 2, total: 40}]) { affected_rows }
+		}`},
+		{"update moving rows to another user", `mutation {
+			update_orders(where: {}, _set: {user_id: 2}) { affected_rows }
+		}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolve(ctx, db, schema, operation(t, schema, test.query), nil, opts)
+			if err == nil || !strings.Contains(err.Error(), "violate its policy") {
+				t.Fatalf("got %v, want a policy violation", err)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM orders WHERE user_id = 1"); n != 1 {
+				t.Errorf("got %d orders of user 1, want the 1 from before the mutation", n)
+			}
+			if n := count(t, db, "SELECT COUNT(*) FROM orders"); n != 2 {
+				t.Errorf("got %d orders, want 2", n)
+			}
+		})
+	}
+
+	// Rows outside the policy are neither returned nor touched
+	data, err := resolve(ctx, db, schema, operation(t, schema, `mutation {
+		delete_orders(where: {}) { affected_rows }
+	}`), nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data["delete_orders"].(map[string]interface{})["affected_rows"]; got != 1 {
+		t.Errorf("deleted %v orders, want 1", got)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	gqlparser "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// Directives understood by the translator. @table maps an object type to a
+// table and lists the columns it has no field for, which only policies can
+// filter on. @relation names the foreign key column that links two tables.
+const directivesSchema = `directive @table(name: String, key: String, columns: [String!]) on OBJECT
+directive @relation(column: String!, references: String) on FIELD_DEFINITION
+`
+
+const pageInfoSchema = `
+	type PageInfo {
+		hasNextPage: Boolean!
+		hasPreviousPage: Boolean!
+		startCursor: String
+		endCursor: String
+	}
+
+	enum order_by {
+		asc
+		asc_nulls_first
+		asc_nulls_last
+		desc
+		desc_nulls_first
+		desc_nulls_last
+	}
+`
+
+type table struct {
+	Name    string
+	Key     string
+	Columns []string
+}
+
+type relation struct {
+	Target     *ast.Definition
+	List       bool
+	Column     string
+	References string
+}
+
+func isRootType(name string) bool {
+	return name == "Query" || name == "Mutation" || name == "Subscription"
+}
+
+func directiveArgument(directives ast.DirectiveList, directive, argument string) string {
+	d := directives.ForName(directive)
+	if d == nil {
+		return ""
+	}
+	arg := d.Arguments.ForName(argument)
+	if arg == nil || arg.Value == nil {
+		return ""
+	}
+	return arg.Value.Raw
+}
+
+// tableFor returns the table backing an object type. Without a @table
+// directive the type name is lowercased and pluralized: User => users.
+func tableFor(def *ast.Definition) table {
+	t := table{
+		Name: directiveArgument(def.Directives, "table", "name"),
+		Key:  directiveArgument(def.Directives, "table", "key"),
+	}
+	if t.Name == "" {
+		t.Name = strings.ToLower(def.Name) + "s"
+	}
+	if t.Key == "" {
+		t.Key = "id"
+	}
+	if d := def.Directives.ForName("table"); d != nil {
+		if arg := d.Arguments.ForName("columns"); arg != nil && arg.Value != nil {
+			for _, child := range arg.Value.Children {
+				t.Columns = append(t.Columns, child.Value.Raw)
+			}
+		}
+	}
+	return t
+}
+
+// relationFor describes how a field of parent joins to another table. A list
+// field is one-to-many and the column lives on the target (User.orders =>
+// orders.user_id), a single field is many-to-one and the column lives on the
+// parent (Order.user => orders.user_id).
+func relationFor(schema *ast.Schema, parent *ast.Definition, field *ast.FieldDefinition) (relation, bool) {
+	target := schema.Types[field.Type.Name()]
+	if target == nil || target.Kind != ast.Object {
+		return relation{}, false
+	}
+
+	rel := relation{
+		Target:     target,
+		List:       field.Type.Elem != nil,
+		Column:     directiveArgument(field.Directives, "relation", "column"),
+		References: directiveArgument(field.Directives, "relation", "references"),
+	}
+	if rel.List {
+		if rel.Column == "" {
+			rel.Column = strings.ToLower(parent.Name) + "_id"
+		}
+		if rel.References == "" {
+			rel.References = tableFor(parent).Key
+		}
+	} else {
+		if rel.Column == "" {
+			rel.Column = field.Name + "_id"
+		}
+		if rel.References == "" {
+			rel.References = tableFor(target).Key
+		}
+	}
+	return rel, true
+}
+
+// buildSchema loads the object types in types and generates everything the
+// translator needs around them: filter, ordering, connection and mutation
+// input types, list and connection fields on Query and insert, update and
+// delete fields on Mutation for every table.
+func buildSchema(types string) (*ast.Schema, error) {
+	sdl, err := generateSchema(types)
+	if err != nil {
+		return nil, err
+	}
+	return gqlparser.LoadSchema(&ast.Source{Name: "Schema", Input: sdl})
+}
+
+// generateSchema returns types extended with the generated definitions as SDL.
+func generateSchema(types string) (string, error) {
+	doc, err := parser.ParseSchema(&ast.Source{Name: "Schema", Input: types})
+	if err != nil {
+		return "", err
+	}
+
+	objects := map[string]*ast.Definition{}
+	for _, def := range doc.Definitions {
+		if def.Kind == ast.Object && !isRootType(def.Name) {
+			objects[def.Name] = def
+		}
+	}
+
+	query := doc.Definitions.ForName("Query")
+	if query == nil {
+		query = &ast.Definition{Kind: ast.Object, Name: "Query"}
+		doc.Definitions = append(doc.Definitions, query)
+	}
+
+	mutation := doc.Definitions.ForName("Mutation")
+	if mutation == nil {
+		mutation = &ast.Definition{Kind: ast.Object, Name: "Mutation"}
+		doc.Definitions = append(doc.Definitions, mutation)
+	}
+
+	generated := &bytes.Buffer{}
+	generated.WriteString(pageInfoSchema)
+
+	comparisons := map[string]bool{}
+	for _, def := range doc.Definitions {
+		if objects[def.Name] == nil {
+			continue
+		}
+
+		for _, field := range def.Fields {
+			target := objects[field.Type.Name()]
+			if target != nil {
+				if field.Type.Elem != nil && len(field.Arguments) == 0 {
+					field.Arguments = relationArguments(target.Name)
+				}
+				continue
+			}
+			comparisons[field.Type.Name()] = true
+		}
+
+		writeFilterTypes(generated, def, objects)
+		writeMutationTypes(generated, def, objects)
+
+		name := tableFor(def).Name
+		if query.Fields.ForName(name) == nil {
+			query.Fields = append(query.Fields, &ast.FieldDefinition{
+				Name: name,
+				Arguments: append(relationArguments(def.Name),
+					&ast.ArgumentDefinition{Name: "limit", Type: ast.NamedType("Int", nil)},
+					&ast.ArgumentDefinition{Name: "offset", Type: ast.NamedType("Int", nil)},
+				),
+				Type: ast.NonNullListType(ast.NonNullNamedType(def.Name, nil), nil),
+			})
+		}
+		if query.Fields.ForName(name+"_connection") == nil {
+			query.Fields = append(query.Fields, &ast.FieldDefinition{
+				Name: name + "_connection",
+				Arguments: append(relationArguments(def.Name),
+					&ast.ArgumentDefinition{Name: "first", Type: ast.NamedType("Int", nil)},
+					&ast.ArgumentDefinition{Name: "after", Type: ast.NamedType("String", nil)},
+				),
+				Type: ast.NonNullNamedType(def.Name+"Connection", nil),
+			})
+		}
+
+		response := ast.NonNullNamedType(def.Name+"_mutation_response", nil)
+		if mutation.Fields.ForName("insert_"+name) == nil {
+			mutation.Fields = append(mutation.Fields, &ast.FieldDefinition{
+				Name: "insert_" + name,
+				Arguments: ast.ArgumentDefinitionList{
+					{Name: "objects", Type: ast.NonNullListType(ast.NonNullNamedType(def.Name+"_insert_input", nil), nil)},
+				},
+				Type: response,
+			})
+		}
+		if mutation.Fields.ForName("update_"+name) == nil {
+			mutation.Fields = append(mutation.Fields, &ast.FieldDefinition{
+				Name: "update_" + name,
+				Arguments: ast.ArgumentDefinitionList{
+					{Name: "where", Type: ast.NonNullNamedType(def.Name+"_bool_exp", nil)},
+					{Name: "_set", Type: ast.NonNullNamedType(def.Name+"_set_input", nil)},
+				},
+				Type: response,
+			})
+		}
+		if mutation.Fields.ForName("delete_"+name) == nil {
+			mutation.Fields = append(mutation.Fields, &ast.FieldDefinition{
+				Name: "delete_" + name,
+				Arguments: ast.ArgumentDefinitionList{
+					{Name: "where", Type: ast.NonNullNamedType(def.Name+"_bool_exp", nil)},
+				},
+				Type: response,
+			})
+		}
+	}
+
+	for _, scalar := range sortedKeys(comparisons) {
+		writeComparisonType(generated, scalar)
+	}
+
+	extra, err := parser.ParseSchema(&ast.Source{Name: "Generated", Input: generated.String()})
+	if err != nil {
+		return "", err
+	}
+	doc.Merge(extra)
+
+	sdl := &bytes.Buffer{}
+	fmt.Fprint(sdl, directivesSchema)
+	formatter.NewFormatter(sdl).FormatSchemaDocument(doc)
+	return sdl.String(), nil
+}
+
+func relationArguments(typeName string) ast.ArgumentDefinitionList {
+	return ast.ArgumentDefinitionList{
+		{Name: "where", Type: ast.NamedType(typeName+"_bool_exp", nil)},
+		{Name: "order_by", Type: ast.ListType(ast.NonNullNamedType(typeName+"_order_by", nil), nil)},
+	}
+}
+
+func writeFilterTypes(w *bytes.Buffer, def *ast.Definition, objects map[string]*ast.Definition) {
+	fmt.Fprintf(w, "input %s_bool_exp {\n", def.Name)
+	fmt.Fprintf(w, "\t_and: [%s_bool_exp!]\n", def.Name)
+	fmt.Fprintf(w, "\t_or: [%s_bool_exp!]\n", def.Name)
+	fmt.Fprintf(w, "\t_not: %s_bool_exp\n", def.Name)
+	for _, field := range def.Fields {
+		if target := objects[field.Type.Name()]; target != nil {
+			fmt.Fprintf(w, "\t%s: %s_bool_exp\n", field.Name, target.Name)
+		} else {
+			fmt.Fprintf(w, "\t%s: %s_comparison_exp\n", field.Name, field.Type.Name())
+		}
+	}
+	w.WriteString("}\n")
+
+	fmt.Fprintf(w, "input %s_order_by {\n", def.Name)
+	for _, field := range def.Fields {
+		if objects[field.Type.Name()] == nil && field.Type.Elem == nil {
+			fmt.Fprintf(w, "\t%s: order_by\n", field.Name)
+		}
+	}
+	w.WriteString("}\n")
+
+	fmt.Fprintf(w, "type %sEdge {\n\tcursor: String!\n\tnode: %s!\n}\n", def.Name, def.Name)
+	fmt.Fprintf(w, "type %sConnection {\n\tedges: [%sEdge!]!\n\tpageInfo: PageInfo!\n}\n", def.Name, def.Name)
+}
+
+func writeMutationTypes(w *bytes.Buffer, def *ast.Definition, objects map[string]*ast.Definition) {
+	for _, input := range []string{"_insert_input", "_set_input"} {
+		fmt.Fprintf(w, "input %s%s {\n", def.Name, input)
+		for _, field := range def.Fields {
+			if objects[field.Type.Name()] == nil {
+				fmt.Fprintf(w, "\t%s: %s\n", field.Name, field.Type.Name())
+			}
+		}
+		w.WriteString("}\n")
+	}
+
+	fmt.Fprintf(w, "type %s_mutation_response {\n\taffected_rows: Int!\n\treturning: [%s!]!\n}\n", def.Name, def.Name)
+}
+
+func writeComparisonType(w *bytes.Buffer, scalar string) {
+	fmt.Fprintf(w, "input %s_comparison_exp {\n", scalar)
+	for _, op := range []string{"_eq", "_neq", "_gt", "_gte", "_lt", "_lte"} {
+		fmt.Fprintf(w, "\t%s: %s\n", op, scalar)
+	}
+	fmt.Fprintf(w, "\t_in: [%s!]\n", scalar)
+	fmt.Fprintf(w, "\t_nin: [%s!]\n", scalar)
+	w.WriteString("\t_is_null: Boolean\n")
+	if scalar == "String" {
+		for _, op := range []string{"_like", "_nlike", "_ilike", "_nilike"} {
+			fmt.Fprintf(w, "\t%s: String\n", op)
+		}
+	}
+	w.WriteString("}\n")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type insertData struct {
+	PlaceholderFormat PlaceholderFormat
+	Into              string
+	Columns           []string
+	Values            [][]interface{}
+	Returning         []string
+}
+
+func (d *insertData) ToSql() (sqlStr string, args []interface{}, err error) {
+	if len(d.Into) == 0 {
+		err = fmt.Errorf("insert statements must specify a table")
+		return
+	}
+	if len(d.Values) == 0 {
+		err = fmt.Errorf("insert statements must have at least one set of values")
+		return
+	}
+
+	sql := &bytes.Buffer{}
+
+	sql.WriteString("INSERT INTO ")
+	sql.WriteString(d.Into)
+
+	if len(d.Columns) == 0 {
+		if len(d.Values) > 1 {
+			err = fmt.Errorf("insert statements without columns can only insert one row")
+			return
+		}
+		sql.WriteString(" DEFAULT VALUES")
+	} else {
+		sql.WriteString(" (")
+		sql.WriteString(strings.Join(d.Columns, ", "))
+		sql.WriteString(") VALUES ")
+
+		for r, row := range d.Values {
+			if len(row) != len(d.Columns) {
+				err = fmt.Errorf("row %d has %d values for %d columns", r, len(row), len(d.Columns))
+				return
+			}
+			if r > 0 {
+				sql.WriteString(", ")
+			}
+			sql.WriteString("(")
+			sql.WriteString(strings.TrimSuffix(strings.Repeat("?, ", len(row)), ", "))
+			sql.WriteString(")")
+			args = append(args, row...)
+		}
+	}
+
+	writeReturning(sql, d.Returning)
+
+	sqlStr, err = d.PlaceholderFormat.ReplacePlaceholders(sql.String())
+	return
+}
+
+type setClause struct {
+	column string
+	value  interface{}
+}
+
+type updateData struct {
+	PlaceholderFormat PlaceholderFormat
+	Table             string
+	SetClauses        []setClause
+	WhereParts        []Sqlizer
+	Returning         []string
+}
+
+func (d *updateData) ToSql() (sqlStr string, args []interface{}, err error) {
+	if len(d.Table) == 0 {
+		err = fmt.Errorf("update statements must specify a table")
+		return
+	}
+	if len(d.SetClauses) == 0 {
+		err = fmt.Errorf("update statements must have at least one Set clause")
+		return
+	}
+
+	sql := &bytes.Buffer{}
+
+	sql.WriteString("UPDATE ")
+	sql.WriteString(d.Table)
+	sql.WriteString(" SET ")
+
+	for i, setClause := range d.SetClauses {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(setClause.column)
+		sql.WriteString(" = ?")
+		args = append(args, setClause.value)
+	}
+
+	if len(d.WhereParts) > 0 {
+		sql.WriteString(" WHERE ")
+		args, err = appendToSql(d.WhereParts, sql, " AND ", args)
+		if err != nil {
+			return
+		}
+	}
+
+	writeReturning(sql, d.Returning)
+
+	sqlStr, err = d.PlaceholderFormat.ReplacePlaceholders(sql.String())
+	return
+}
+
+type deleteData struct {
+	PlaceholderFormat PlaceholderFormat
+	From              string
+	WhereParts        []Sqlizer
+	Returning         []string
+}
+
+func (d *deleteData) ToSql() (sqlStr string, args []interface{}, err error) {
+	if len(d.From) == 0 {
+		err = fmt.Errorf("delete statements must specify a From table")
+		return
+	}
+
+	sql := &bytes.Buffer{}
+
+	sql.WriteString("DELETE FROM ")
+	sql.WriteString(d.From)
+
+	if len(d.WhereParts) > 0 {
+		sql.WriteString(" WHERE ")
+		args, err = appendToSql(d.WhereParts, sql, " AND ", args)
+		if err != nil {
+			return
+		}
+	}
+
+	writeReturning(sql, d.Returning)
+
+	sqlStr, err = d.PlaceholderFormat.ReplacePlaceholders(sql.String())
+	return
+}
+
+func writeReturning(sql *bytes.Buffer, columns []string) {
+	if len(columns) > 0 {
+		sql.WriteString(" RETURNING ")
+		sql.WriteString(strings.Join(columns, ", "))
+	}
+}
@@ -0,0 +1,849 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var comparisonOperators = map[string]string{
+	"_eq":    "=",
+	"_neq":   "<>",
+	"_gt":    ">",
+	"_gte":   ">=",
+	"_lt":    "<",
+	"_lte":   "<=",
+	"_like":  "LIKE",
+	"_nlike": "NOT LIKE",
+}
+
+var orderDirections = map[string]orderItem{
+	"asc":              {},
+	"asc_nulls_first":  {Nulls: "FIRST"},
+	"asc_nulls_last":   {Nulls: "LAST"},
+	"desc":             {Desc: true},
+	"desc_nulls_first": {Desc: true, Nulls: "FIRST"},
+	"desc_nulls_last":  {Desc: true, Nulls: "LAST"},
+}
+
+// fieldQuery is a root field compiled to a single SELECT, together with the
+// tree that shapes its flat rows back into the GraphQL response.
+type fieldQuery struct {
+	Select *selectData
+	Root   *node
+}
+
+// node is one object level of the response. Every node selects its table's
+// key so that joined rows can be grouped back into nested lists.
+type node struct {
+	Key        string
+	Def        *ast.Definition
+	Table      table
+	Alias      string
+	List       bool
+	KeyIndex   int
+	Fields     []column
+	Children   []*node
+	Connection *connection
+}
+
+// column is a response field read from position Index of a row. Fields that
+// don't come from the database (__typename) have Index -1 and a Const value.
+type column struct {
+	Key   string
+	Index int
+	Const interface{}
+}
+
+// connection is a Relay connection field. First is nil when the field
+// returns every node.
+type connection struct {
+	Selection ast.SelectionSet
+	First     *int
+	After     bool
+	Cursor    []int
+}
+
+type orderItem struct {
+	Column   string
+	Desc     bool
+	Nulls    string
+	Nullable bool
+}
+
+func (o orderItem) ToSql() (string, []interface{}, error) {
+	sql := o.Column
+	if o.Desc {
+		sql += " DESC"
+	}
+	if o.Nulls != "" {
+		sql += " NULLS " + o.Nulls
+	}
+	return sql, nil, nil
+}
+
+type arguments struct {
+	Where   []Sqlizer
+	OrderBy []orderItem
+	Limit   string
+	Offset  string
+	First   *int
+	After   string
+}
+
+// translator compiles one root field. policies are those of the field's
+// action; reads are the select policies a mutation's returned rows must also
+// satisfy. A nil map leaves every table unrestricted.
+type translator struct {
+	ctx      context.Context
+	schema   *ast.Schema
+	vars     map[string]interface{}
+	policies map[string]Policy
+	reads    map[string]Policy
+	trusted  bool
+	aliases  int
+	columns  []Sqlizer
+	indexes  map[string]int
+	joins    []Sqlizer
+	order    []orderItem
+}
+
+func newTranslator(ctx context.Context, schema *ast.Schema, vars map[string]interface{}, policies map[string]Policy) *translator {
+	return &translator{ctx: ctx, schema: schema, vars: vars, policies: policies, indexes: map[string]int{}}
+}
+
+func (t *translator) alias() string {
+	alias := fmt.Sprintf("t%d", t.aliases)
+	t.aliases++
+	return alias
+}
+
+// column selects expr once and returns its position in the result row.
+func (t *translator) column(expr string) int {
+	if index, ok := t.indexes[expr]; ok {
+		return index
+	}
+	t.columns = append(t.columns, newPart(expr))
+	t.indexes[expr] = len(t.columns) - 1
+	return len(t.columns) - 1
+}
+
+// query compiles a root field: arguments become WHERE, ORDER BY and LIMIT,
+// nested relations become LEFT JOINs. When the root is paginated and has
+// joins, the root table is limited in a subquery so that LIMIT counts
+// objects instead of joined rows.
+func (t *translator) query(field *ast.Field) (*fieldQuery, error) {
+	def := t.schema.Types[field.Definition.Type.Name()]
+	root := &node{Key: field.Alias, Def: def, List: field.Definition.Type.Elem != nil}
+	selection := field.SelectionSet
+
+	if nodeDef := connectionNode(t.schema, def); nodeDef != nil {
+		root.Def = nodeDef
+		root.Connection = &connection{Selection: field.SelectionSet}
+		selection = connectionSelection(field.SelectionSet)
+	}
+	root.Table = tableFor(root.Def)
+	root.Alias = t.alias()
+
+	args, err := t.arguments(root, field)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := t.policy(root.Def, root.Alias)
+	if err != nil {
+		return nil, err
+	}
+
+	where, order := append(policy, args.Where...), args.OrderBy
+	limit, offset := args.Limit, args.Offset
+	if root.Connection != nil {
+		order = withKey(order, root.Alias+"."+root.Table.Key)
+		// Cursors compare against NULLs, so where they sort can't be left to
+		// the database: Postgres puts them last and SQLite first
+		for i, o := range order {
+			if o.Nullable && o.Nulls == "" {
+				order[i].Nulls = "LAST"
+				if o.Desc {
+					order[i].Nulls = "FIRST"
+				}
+			}
+		}
+		if args.After != "" {
+			keyset, err := keysetPredicate(order, args.After)
+			if err != nil {
+				return nil, err
+			}
+			where = append(where, keyset)
+		}
+		if args.First != nil {
+			limit = strconv.Itoa(*args.First + 1)
+		}
+		root.Connection.First = args.First
+		root.Connection.After = args.After != ""
+	}
+
+	if err := t.selection(root, selection); err != nil {
+		return nil, err
+	}
+	if root.Connection != nil {
+		for _, o := range order {
+			root.Connection.Cursor = append(root.Connection.Cursor, t.column(o.Column))
+		}
+	}
+
+	from := newPart(fmt.Sprintf("%s AS %s", root.Table.Name, root.Alias))
+	d := &selectData{
+		PlaceholderFormat: dollarFormat{},
+		Columns:           t.columns,
+		From:              from,
+		Joins:             t.joins,
+		OrderByParts:      orderParts(append(order, t.order...)),
+	}
+	if len(t.joins) > 0 && (limit != "" || offset != "") {
+		d.From = aliasPart{&selectData{
+			Columns:      []Sqlizer{newPart(root.Alias + ".*")},
+			From:         from,
+			WhereParts:   where,
+			OrderByParts: orderParts(order),
+			Limit:        limit,
+			Offset:       offset,
+		}, root.Alias}
+	} else {
+		d.WhereParts = where
+		d.Limit = limit
+		d.Offset = offset
+	}
+
+	return &fieldQuery{Select: d, Root: root}, nil
+}
+
+// objects compiles a plain list of def objects with the given selection and
+// no filtering, for callers that add their own WhereParts.
+func (t *translator) objects(def *ast.Definition, selection ast.SelectionSet) (*fieldQuery, error) {
+	root := &node{Def: def, Table: tableFor(def), Alias: t.alias(), List: true}
+	policy, err := t.policy(root.Def, root.Alias)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.selection(root, selection); err != nil {
+		return nil, err
+	}
+
+	return &fieldQuery{Select: &selectData{
+		PlaceholderFormat: dollarFormat{},
+		Columns:           t.columns,
+		From:              newPart(fmt.Sprintf("%s AS %s", root.Table.Name, root.Alias)),
+		Joins:             t.joins,
+		WhereParts:        policy,
+		OrderByParts:      orderParts(t.order),
+	}, Root: root}, nil
+}
+
+// selection adds the columns of n's selection set and joins its relations.
+func (t *translator) selection(n *node, set ast.SelectionSet) error {
+	n.KeyIndex = t.column(n.Alias + "." + n.Table.Key)
+
+	for _, field := range collectFields(set) {
+		if field.Name == "__typename" {
+			n.Fields = append(n.Fields, column{Key: field.Alias, Index: -1, Const: n.Def.Name})
+			continue
+		}
+
+		rel, ok := relationFor(t.schema, n.Def, field.Definition)
+		if !ok {
+			n.Fields = append(n.Fields, column{Key: field.Alias, Index: t.column(n.Alias + "." + field.Name)})
+			continue
+		}
+
+		child := &node{
+			Key:   field.Alias,
+			Def:   rel.Target,
+			Table: tableFor(rel.Target),
+			Alias: t.alias(),
+			List:  rel.List,
+		}
+		args, err := t.arguments(child, field)
+		if err != nil {
+			return err
+		}
+		if args.Limit != "" || args.Offset != "" || args.First != nil || args.After != "" {
+			return fmt.Errorf("pagination is only supported on root fields, not on %s", field.Name)
+		}
+
+		policy, err := t.policy(child.Def, child.Alias)
+		if err != nil {
+			return err
+		}
+		on := And{newPart(joinCondition(n.Alias, child.Alias, rel))}
+		for _, where := range append(policy, args.Where...) {
+			on = append(on, where)
+		}
+		onSql, onArgs, err := on.ToSql()
+		if err != nil {
+			return err
+		}
+		t.joins = append(t.joins, newPart(
+			fmt.Sprintf("LEFT JOIN %s AS %s ON %s", child.Table.Name, child.Alias, onSql), onArgs...,
+		))
+		t.order = append(t.order, args.OrderBy...)
+
+		n.Children = append(n.Children, child)
+		if err := t.selection(child, field.SelectionSet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *translator) arguments(n *node, field *ast.Field) (arguments, error) {
+	var args arguments
+	for _, arg := range field.Arguments {
+		value, err := literal(arg.Value, t.vars)
+		if err != nil {
+			return args, err
+		}
+		if value == nil {
+			continue
+		}
+
+		switch arg.Name {
+		case "where":
+			exp, err := t.boolExp(n.Def, n.Alias, value)
+			if err != nil {
+				return args, err
+			}
+			args.Where = append(args.Where, exp)
+		case "order_by":
+			args.OrderBy, err = t.orderBy(n.Def, n.Alias, value)
+			if err != nil {
+				return args, err
+			}
+		case "limit", "offset", "first":
+			i, err := asInt(value)
+			if err != nil {
+				return args, fmt.Errorf("argument %s: %w", arg.Name, err)
+			}
+			switch arg.Name {
+			case "limit":
+				args.Limit = strconv.Itoa(i)
+			case "offset":
+				args.Offset = strconv.Itoa(i)
+			case "first":
+				args.First = &i
+			}
+		case "after":
+			after, ok := value.(string)
+			if !ok {
+				return args, fmt.Errorf("argument after must be a string")
+			}
+			args.After = after
+		default:
+			fieldDef := n.Def.Fields.ForName(arg.Name)
+			if fieldDef == nil {
+				return args, fmt.Errorf("unknown argument %s on %s", arg.Name, field.Name)
+			}
+			if _, ok := relationFor(t.schema, n.Def, fieldDef); ok {
+				return args, fmt.Errorf("argument %s on %s refers to a relation", arg.Name, field.Name)
+			}
+			args.Where = append(args.Where, newPart(fmt.Sprintf("%s.%s = ?", n.Alias, arg.Name), value))
+		}
+	}
+	return args, nil
+}
+
+// boolExp translates a Hasura-style boolean expression over def, e.g.
+// {age: {_gt: 30}, _or: [{name: {_eq: "John"}}, {orders: {total: {_gt: 100}}}]}.
+// Conditions on relations become EXISTS subqueries.
+func (t *translator) boolExp(def *ast.Definition, alias string, value interface{}) (Sqlizer, error) {
+	fields, err := asObject(value)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := And{}
+	for _, f := range fields {
+		switch f.Name {
+		case "_and", "_or":
+			items := conj{}
+			for _, item := range asList(f.Value) {
+				exp, err := t.boolExp(def, alias, item)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, exp)
+			}
+			if f.Name == "_and" {
+				parts = append(parts, And(items))
+			} else {
+				parts = append(parts, Or(items))
+			}
+		case "_not":
+			exp, err := t.boolExp(def, alias, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, Not{exp})
+		default:
+			fieldDef := def.Fields.ForName(f.Name)
+			if fieldDef == nil && !(t.trusted && t.hiddenColumn(def, f.Name)) {
+				return nil, fmt.Errorf("unknown field %s on %s", f.Name, def.Name)
+			}
+			if fieldDef == nil {
+				exp, err := comparison(alias+"."+f.Name, f.Value)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, exp)
+				continue
+			}
+			if rel, ok := relationFor(t.schema, def, fieldDef); ok {
+				exp, err := t.relationExists(alias, rel, f.Value)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, exp)
+				continue
+			}
+			exp, err := comparison(alias+"."+f.Name, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, exp)
+		}
+	}
+	return parts, nil
+}
+
+func (t *translator) relationExists(parent string, rel relation, value interface{}) (Sqlizer, error) {
+	alias := t.alias()
+	policy, err := t.policy(rel.Target, alias)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := t.boolExp(rel.Target, alias, value)
+	if err != nil {
+		return nil, err
+	}
+	where := []Sqlizer{newPart(joinCondition(parent, alias, rel))}
+	return Exists{&selectData{
+		Columns:    []Sqlizer{newPart("1")},
+		From:       newPart(fmt.Sprintf("%s AS %s", tableFor(rel.Target).Name, alias)),
+		WhereParts: append(append(where, policy...), exp),
+	}}, nil
+}
+
+// policy evaluates the policy of def's table for the current request and
+// compiles it against alias. When policies are enforced, a table without one
+// can't be read or written at all. Policies may filter on columns the GraphQL
+// type doesn't expose, such as a tenant's project_id, as long as the table
+// declares them.
+func (t *translator) policy(def *ast.Definition, alias string) ([]Sqlizer, error) {
+	if t.policies == nil {
+		return nil, nil
+	}
+	tbl := tableFor(def)
+	policy := t.policies[tbl.Name]
+	if policy == nil {
+		return []Sqlizer{newPart("(1=0)")}, nil
+	}
+
+	value, err := policy(t.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("policy on %s: %w", tbl.Name, err)
+	}
+	trusted := t.trusted
+	t.trusted = true
+	exp, err := t.boolExp(def, alias, value)
+	t.trusted = trusted
+	if err != nil {
+		return nil, fmt.Errorf("policy on %s: %w", tbl.Name, err)
+	}
+	return []Sqlizer{exp}, nil
+}
+
+// readPolicy compiles the select policy of def's table against alias, for
+// the rows a mutation returns.
+func (t *translator) readPolicy(def *ast.Definition, alias string) ([]Sqlizer, error) {
+	policies := t.policies
+	t.policies = t.reads
+	defer func() { t.policies = policies }()
+	return t.policy(def, alias)
+}
+
+// hiddenColumn reports whether name is a column of def's table that the type
+// has no field for: one listed in its @table directive or the foreign key of
+// a many-to-one relation.
+func (t *translator) hiddenColumn(def *ast.Definition, name string) bool {
+	for _, column := range tableFor(def).Columns {
+		if column == name {
+			return true
+		}
+	}
+	for _, field := range def.Fields {
+		if rel, ok := relationFor(t.schema, def, field); ok && !rel.List && rel.Column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func comparison(column string, value interface{}) (Sqlizer, error) {
+	fields, err := asObject(value)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := And{}
+	for _, f := range fields {
+		switch f.Name {
+		case "_in", "_nin":
+			list := asList(f.Value)
+			if len(list) == 0 {
+				if f.Name == "_in" {
+					parts = append(parts, newPart("(1=0)"))
+				} else {
+					parts = append(parts, newPart("(1=1)"))
+				}
+				continue
+			}
+			op := "IN"
+			if f.Name == "_nin" {
+				op = "NOT IN"
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ")
+			parts = append(parts, newPart(fmt.Sprintf("%s %s (%s)", column, op, placeholders), list...))
+		case "_is_null":
+			isNull, ok := f.Value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("_is_null on %s must be a boolean", column)
+			}
+			if isNull {
+				parts = append(parts, newPart(column+" IS NULL"))
+			} else {
+				parts = append(parts, newPart(column+" IS NOT NULL"))
+			}
+		case "_ilike", "_nilike":
+			op := "LIKE"
+			if f.Name == "_nilike" {
+				op = "NOT LIKE"
+			}
+			parts = append(parts, newPart(fmt.Sprintf("LOWER(%s) %s LOWER(?)", column, op), f.Value))
+		default:
+			op, ok := comparisonOperators[f.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown operator %s on %s", f.Name, column)
+			}
+			if f.Value == nil {
+				return nil, fmt.Errorf("%s on %s cannot be null, use _is_null", f.Name, column)
+			}
+			parts = append(parts, newPart(fmt.Sprintf("%s %s ?", column, op), f.Value))
+		}
+	}
+	return parts, nil
+}
+
+// orderBy accepts a single {field: direction} object or a list of them, the
+// list form being the only way to order by several fields deterministically.
+// Only scalar columns can be ordered by, not relations or lists.
+func (t *translator) orderBy(def *ast.Definition, alias string, value interface{}) ([]orderItem, error) {
+	var items []orderItem
+	for _, item := range asList(value) {
+		fields, err := asObject(item)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			fieldDef := def.Fields.ForName(f.Name)
+			if fieldDef == nil {
+				return nil, fmt.Errorf("unknown field %s on %s", f.Name, def.Name)
+			}
+			if _, ok := relationFor(t.schema, def, fieldDef); ok || fieldDef.Type.Elem != nil {
+				return nil, fmt.Errorf("cannot order by %s on %s, which is not a column", f.Name, def.Name)
+			}
+			direction, _ := f.Value.(string)
+			o, ok := orderDirections[direction]
+			if !ok {
+				return nil, fmt.Errorf("invalid order_by direction %v for %s", f.Value, f.Name)
+			}
+			o.Column = alias + "." + f.Name
+			o.Nullable = !fieldDef.Type.NonNull
+			items = append(items, o)
+		}
+	}
+	return items, nil
+}
+
+func orderParts(items []orderItem) []Sqlizer {
+	parts := make([]Sqlizer, len(items))
+	for i, item := range items {
+		parts[i] = item
+	}
+	return parts
+}
+
+// withKey appends the key column to an ordering so that cursors are unique.
+func withKey(order []orderItem, key string) []orderItem {
+	for _, o := range order {
+		if o.Column == key {
+			return order
+		}
+	}
+	return append(order, orderItem{Column: key})
+}
+
+// keysetPredicate expands (a, b) > (x, y) for mixed directions:
+// a > x OR (a = x AND b > y), flipping the comparison for DESC columns.
+// Nullable columns must have their NULLS ordering set.
+func keysetPredicate(order []orderItem, cursor string) (Sqlizer, error) {
+	values, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(order) {
+		return nil, fmt.Errorf("cursor does not match the requested order_by")
+	}
+
+	predicate := Or{}
+	for i, o := range order {
+		parts := And{}
+		for j := 0; j < i; j++ {
+			parts = append(parts, keysetEqual(order[j], values[j]))
+		}
+		parts = append(parts, keysetAfter(o, values[i]))
+		predicate = append(predicate, parts)
+	}
+	return predicate, nil
+}
+
+func keysetEqual(o orderItem, value interface{}) Sqlizer {
+	if value == nil {
+		return newPart(o.Column + " IS NULL")
+	}
+	return newPart(o.Column+" = ?", value)
+}
+
+// keysetAfter matches the values of o's column that sort after value. NULLs
+// are all equal and sort before or after every other value.
+func keysetAfter(o orderItem, value interface{}) Sqlizer {
+	op := ">"
+	if o.Desc {
+		op = "<"
+	}
+	nullsLast := o.Nulls == "LAST"
+	switch {
+	case !o.Nullable:
+		return newPart(fmt.Sprintf("%s %s ?", o.Column, op), value)
+	case value == nil && nullsLast:
+		return newPart("(1=0)")
+	case value == nil:
+		return newPart(o.Column + " IS NOT NULL")
+	case nullsLast:
+		return newPart(fmt.Sprintf("(%s %s ? OR %s IS NULL)", o.Column, op, o.Column), value)
+	default:
+		return newPart(fmt.Sprintf("%s %s ?", o.Column, op), value)
+	}
+}
+
+func encodeCursor(values []interface{}) string {
+	data, _ := json.Marshal(values)
+	return base64.URLEncoding.EncodeToString(data)
+}
+
+// decodeCursor keeps integers exact: they come back as int64, and other
+// numbers as the json.Number they were encoded as rather than a float64.
+func decodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	for i, value := range values {
+		if n, ok := value.(json.Number); ok {
+			if integer, err := n.Int64(); err == nil {
+				values[i] = integer
+			}
+		}
+	}
+	return values, nil
+}
+
+func joinCondition(parent, alias string, rel relation) string {
+	if rel.List {
+		return fmt.Sprintf("%s.%s = %s.%s", alias, rel.Column, parent, rel.References)
+	}
+	return fmt.Sprintf("%s.%s = %s.%s", alias, rel.References, parent, rel.Column)
+}
+
+// connectionNode returns the node type of a Relay connection type.
+func connectionNode(schema *ast.Schema, def *ast.Definition) *ast.Definition {
+	if def == nil || !strings.HasSuffix(def.Name, "Connection") || def.Fields.ForName("pageInfo") == nil {
+		return nil
+	}
+	edges := def.Fields.ForName("edges")
+	if edges == nil {
+		return nil
+	}
+	edge := schema.Types[edges.Type.Name()]
+	if edge == nil || edge.Fields.ForName("node") == nil {
+		return nil
+	}
+	return schema.Types[edge.Fields.ForName("node").Type.Name()]
+}
+
+// connectionSelection merges the selection sets of every edges.node field.
+func connectionSelection(set ast.SelectionSet) ast.SelectionSet {
+	var selection ast.SelectionSet
+	for _, edges := range collectFields(set) {
+		if edges.Name != "edges" {
+			continue
+		}
+		for _, node := range collectFields(edges.SelectionSet) {
+			if node.Name == "node" {
+				selection = append(selection, node.SelectionSet...)
+			}
+		}
+	}
+	return selection
+}
+
+func collectFields(set ast.SelectionSet) []*ast.Field {
+	var fields []*ast.Field
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			fields = append(fields, sel)
+		case *ast.InlineFragment:
+			fields = append(fields, collectFields(sel.SelectionSet)...)
+		case *ast.FragmentSpread:
+			if sel.Definition != nil {
+				fields = append(fields, collectFields(sel.Definition.SelectionSet)...)
+			}
+		}
+	}
+	return fields
+}
+
+type objectField struct {
+	Name  string
+	Value interface{}
+}
+
+// literal converts an argument to plain Go values. Input objects become
+// []objectField so that their field order survives, which matters for
+// order_by and keeps the generated SQL deterministic.
+func literal(v *ast.Value, vars map[string]interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch v.Kind {
+	case ast.Variable:
+		value, err := v.Value(vars)
+		if err != nil {
+			return nil, err
+		}
+		return ordered(value), nil
+	case ast.ListValue:
+		list := []interface{}{}
+		for _, child := range v.Children {
+			item, err := literal(child.Value, vars)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case ast.ObjectValue:
+		fields := []objectField{}
+		for _, child := range v.Children {
+			value, err := literal(child.Value, vars)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, objectField{child.Name, value})
+		}
+		return fields, nil
+	default:
+		return v.Value(vars)
+	}
+}
+
+func ordered(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]objectField, len(keys))
+		for i, key := range keys {
+			fields[i] = objectField{key, ordered(value[key])}
+		}
+		return fields
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = ordered(item)
+		}
+		return list
+	default:
+		return value
+	}
+}
+
+func asObject(value interface{}) ([]objectField, error) {
+	fields, ok := value.([]objectField)
+	if !ok {
+		return nil, fmt.Errorf("expected an input object, got %T", value)
+	}
+	return fields, nil
+}
+
+// asList applies GraphQL input coercion: a single value is a list of one.
+func asList(value interface{}) []interface{} {
+	if list, ok := value.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{value}
+}
+
+func asInt(value interface{}) (int, error) {
+	var i int
+	switch value := value.(type) {
+	case int:
+		i = value
+	case int64:
+		i = int(value)
+	case float64:
+		if value >= math.MaxInt64 || value <= math.MinInt64 {
+			return 0, fmt.Errorf("%v is out of range", value)
+		}
+		i = int(value)
+	case json.Number:
+		n, err := value.Int64()
+		if err != nil {
+			return 0, err
+		}
+		i = int(n)
+	default:
+		return 0, fmt.Errorf("expected an integer, got %T", value)
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return i, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	gqlparser "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const testTypes = `
+	type User {
+		id: ID!
+		name: String!
+		age: Int
+		nickname: String
+		tags: [String!]
+		orders: [Order!]
+	}
+	type Order {
+		id: ID!
+		user_id: Int!
+		total: Float!
+	}
+`
+
+const testTables = `
+	CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER, nickname TEXT, tags TEXT);
+	CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL, total REAL NOT NULL);
+`
+
+func testSchema(t *testing.T) *ast.Schema {
+	t.Helper()
+	schema, err := buildSchema(testTypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// testDB opens a private in-memory SQLite database. It is limited to one
+// connection, as every connection to :memory: opens a database of its own.
+func testDB(t *testing.T, statements ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range append([]string{testTables}, statements...) {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	return db
+}
+
+func operation(t *testing.T, schema *ast.Schema, query string) *ast.OperationDefinition {
+	t.Helper()
+	doc, errs := gqlparser.LoadQuery(schema, query)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return doc.Operations[0]
+}
+
+// compile translates the first root field of query to SQL.
+func compile(t *testing.T, query string, vars map[string]interface{}) (string, []interface{}, error) {
+	t.Helper()
+	schema := testSchema(t)
+	field := collectFields(operation(t, schema, query).SelectionSet)[0]
+	q, err := newTranslator(context.Background(), schema, vars, nil).query(field)
+	if err != nil {
+		return "", nil, err
+	}
+	return q.Select.ToSql()
+}
+
+func TestWhereAndOrderBy(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		sql   string
+		args  []interface{}
+	}{
+		{
+			name:  "comparisons",
+			query: `{ users(where: {age: {_gte: 18, _lt: 65}, name: {_ilike: "j%"}}) { id } }`,
+			sql:   "SELECT t0.id FROM users AS t0 WHERE ((t0.age >= $1 AND t0.age < $2) AND (LOWER(t0.name) LIKE LOWER($3)))",
+			args:  []interface{}{int64(18), int64(65), "j%"},
+		},
+		{
+			name:  "boolean operators",
+			query: `{ users(where: {_or: [{name: {_eq: "John"}}, {_not: {age: {_is_null: true}}}]}) { id } }`,
+			sql:   "SELECT t0.id FROM users AS t0 WHERE ((((t0.name = $1)) OR (NOT (((t0.age IS NULL))))))",
+			args:  []interface{}{"John"},
+		},
+		{
+			name:  "in and empty in",
+			query: `{ users(where: {age: {_in: [1, 2]}, name: {_in: []}}) { id } }`,
+			sql:   "SELECT t0.id FROM users AS t0 WHERE ((t0.age IN ($1, $2)) AND ((1=0)))",
+			args:  []interface{}{int64(1), int64(2)},
+		},
+		{
+			name:  "relation filter",
+			query: `{ users(where: {orders: {total: {_gt: 100}}}) { id } }`,
+			sql:   "SELECT t0.id FROM users AS t0 WHERE (EXISTS (SELECT 1 FROM orders AS t1 WHERE t1.user_id = t0.id AND ((t1.total > $1))))",
+			args:  []interface{}{int64(100)},
+		},
+		{
+			name:  "order, limit and offset",
+			query: `{ users(order_by: [{age: desc_nulls_last}, {name: asc}], limit: 10, offset: 20) { id } }`,
+			sql:   "SELECT t0.id FROM users AS t0 ORDER BY t0.age DESC NULLS LAST, t0.name LIMIT 10 OFFSET 20",
+		},
+		{
+			name:  "paginated root with joins",
+			query: `{ users(limit: 2) { id orders(order_by: {total: desc}) { id } } }`,
+			sql:   "SELECT t0.id, t1.id FROM (SELECT t0.* FROM users AS t0 LIMIT 2) AS t0 LEFT JOIN orders AS t1 ON (t1.user_id = t0.id) ORDER BY t1.total DESC",
+		},
+		{
+			name:  "connection on a nullable column",
+			query: `{ users_connection(first: 2, order_by: {nickname: asc}) { edges { node { id } } } }`,
+			sql:   "SELECT t0.id, t0.nickname FROM users AS t0 ORDER BY t0.nickname NULLS LAST, t0.id LIMIT 3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sql, args, err := compile(t, test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != test.sql {
+				t.Errorf("got SQL\n%s\nwant\n%s", sql, test.sql)
+			}
+			if len(args) != 0 || len(test.args) != 0 {
+				if !reflect.DeepEqual(args, test.args) {
+					t.Errorf("got args %#v, want %#v", args, test.args)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderByRejectsNonColumns(t *testing.T) {
+	// Variables skip the validation of the order_by input type
+	query := `query($order: [User_order_by!]) { users(order_by: $order) { id } }`
+	for _, field := range []string{"orders", "tags"} {
+		_, _, err := compile(t, query, map[string]interface{}{
+			"order": map[string]interface{}{field: "asc"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "not a column") {
+			t.Errorf("order by %s: got %v, want an error", field, err)
+		}
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	db := testDB(t, `INSERT INTO users (id, name, nickname) VALUES
+		(1, 'a', 'x'), (2, 'b', NULL), (3, 'c', 'w'), (4, 'd', NULL),
+		(5, 'e', 'x'), (6, 'f', 'y'), (7, 'g', NULL)`)
+	schema := testSchema(t)
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"asc", []string{"c", "a", "e", "f", "b", "d", "g"}},
+		{"desc", []string{"b", "d", "g", "f", "a", "e", "c"}},
+		{"asc_nulls_first", []string{"b", "d", "g", "c", "a", "e", "f"}},
+		{"desc_nulls_last", []string{"f", "a", "e", "c", "b", "d", "g"}},
+	}
+	for _, test := range tests {
+		t.Run(test.order, func(t *testing.T) {
+			query := `query($after: String) {
+				users_connection(first: 2, after: $after, order_by: {nickname: ` + test.order + `}) {
+					edges { node { name } }
+					pageInfo { hasNextPage endCursor }
+				}
+			}`
+			got := paginate(t, db, schema, query)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeysetCursorKeepsLargeIntegers(t *testing.T) {
+	// Both keys round to the same float64
+	db := testDB(t, `INSERT INTO users (id, name) VALUES (9007199254740993, 'a'), (9007199254740994, 'b')`)
+	query := `query($after: String) {
+		users_connection(first: 1, after: $after) {
+			edges { node { name } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+	got := paginate(t, db, testSchema(t), query)
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestConnectionFirst(t *testing.T) {
+	db := testDB(t, `INSERT INTO users (id, name) VALUES (1, 'a'), (2, 'b')`)
+	schema := testSchema(t)
+	query := `query($first: Int) {
+		users_connection(first: $first) {
+			edges { node { name } }
+			pageInfo { hasNextPage }
+		}
+	}`
+
+	tests := []struct {
+		first       interface{}
+		edges       int
+		hasNextPage bool
+	}{
+		{nil, 2, false},
+		{0, 0, true},
+		{1, 1, true},
+		{2, 2, false},
+	}
+	for _, test := range tests {
+		data, err := resolve(context.Background(), db, schema, operation(t, schema, query), map[string]interface{}{"first": test.first}, options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connection := data["users_connection"].(map[string]interface{})
+		edges := connection["edges"].([]interface{})
+		hasNextPage := connection["pageInfo"].(map[string]interface{})["hasNextPage"]
+		if len(edges) != test.edges || hasNextPage != test.hasNextPage {
+			t.Errorf("first: %v: got %d edges and hasNextPage %v, want %d and %v", test.first, len(edges), hasNextPage, test.edges, test.hasNextPage)
+		}
+	}
+
+	_, err := resolve(context.Background(), db, schema, operation(t, schema, query), map[string]interface{}{"first": -1}, options{})
+	if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("got %v, want first: -1 to be rejected", err)
+	}
+}
+
+// paginate follows endCursor through every page of a users_connection query
+// and returns the names it read.
+func paginate(t *testing.T, db *sql.DB, schema *ast.Schema, query string) []string {
+	t.Helper()
+	op := operation(t, schema, query)
+	var names []string
+	vars := map[string]interface{}{}
+	for page := 0; page < 10; page++ {
+		data, err := resolve(context.Background(), db, schema, op, vars, options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connection := data["users_connection"].(map[string]interface{})
+		for _, edge := range connection["edges"].([]interface{}) {
+			node := edge.(map[string]interface{})["node"].(map[string]interface{})
+			names = append(names, node["name"].(string))
+		}
+		pageInfo := connection["pageInfo"].(map[string]interface{})
+		if !pageInfo["hasNextPage"].(bool) {
+			return names
+		}
+		vars["after"] = pageInfo["endCursor"]
+	}
+	t.Fatal("pagination did not end")
+	return nil
+}